@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIConfig enables the HTTP API
+type APIConfig struct {
+	Listen string `yaml:"listen"` // Address to listen on, e.g. ":8080"
+}
+
+// serveAPI starts the HTTP API and dashboard; every API endpoint requires a token created with "ping_monitor token create"
+func (m *monitor) serveAPI(listen string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status", m.requireScope(scopeRead, m.handleStatus))
+	mux.HandleFunc("/api/version", m.requireScope(scopeRead, m.handleVersion))
+	mux.HandleFunc("/api/sites", m.requireScope(scopeRead, m.handleSites))
+	mux.HandleFunc("/api/export", m.requireScope(scopeRead, m.handleExport))
+	mux.HandleFunc("/api/import", m.requireScope(scopeWrite, m.handleImport))
+	mux.HandleFunc("/api/reload", m.requireScope(scopeWrite, m.handleReload))
+	mux.HandleFunc("/api/blackouts", m.requireScope(scopeRead, m.handleBlackouts))
+	mux.HandleFunc("/api/notes", m.requireScope(scopeRead, m.handleNotes))
+	mux.HandleFunc("/api/incidents", m.requireScope(scopeRead, m.handleIncidents))
+	mux.HandleFunc("/api/incidents/", m.requireScope(scopeRead, m.handleIncident))
+	mux.HandleFunc("/metrics", m.requireScope(scopeRead, m.handleMetrics))
+	mux.HandleFunc("/chatops/", m.handleChatOps) // Authenticated with the chat's own token
+	mux.HandleFunc("/", m.handleDashboard)
+
+	fmt.Printf("API listening on %s\n", listen)
+	if err := http.ListenAndServe(listen, mux); err != nil {
+		fmt.Printf("API server stopped: %v\n", err)
+	}
+}
+
+// requireScope rejects requests without a bearer token granting scope
+func (m *monitor) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		value := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		token, ok := authenticateToken(m.state, value)
+		if !ok {
+			http.Error(w, "invalid or missing API token", http.StatusUnauthorized)
+			return
+		}
+		if !token.HasScope(scope) {
+			http.Error(w, fmt.Sprintf("token lacks the %s scope", scope), http.StatusForbidden)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), tokenContextKey{}, token)))
+	}
+}
+
+type tokenContextKey struct{}
+
+// requestToken returns the token a request was authenticated with
+func requestToken(r *http.Request) APIToken {
+	token, _ := r.Context().Value(tokenContextKey{}).(APIToken)
+	return token
+}
+
+// handleStatus returns the results of the last completed cycle
+func (m *monitor) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	m.mu.Lock()
+	snapshot := m.lastSnapshot
+	m.mu.Unlock()
+	writeJSON(w, snapshot)
+}
+
+// handleBlackouts lists the blackouts that have not ended yet
+func (m *monitor) handleBlackouts(w http.ResponseWriter, r *http.Request) {
+	blackouts, err := m.state.Blackouts()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if blackouts == nil {
+		blackouts = []Blackout{}
+	}
+	writeJSON(w, blackouts)
+}
+
+// handleMetrics exposes the device states and metrics about the monitor itself in the Prometheus text format
+func (m *monitor) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	snapshot := m.lastSnapshot
+	m.mu.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP pinggo_device_state Current state of the device, 1 for the active state.\n")
+	b.WriteString("# TYPE pinggo_device_state gauge\n")
+	for _, result := range snapshot.Results {
+		for _, state := range allStates {
+			value := 0
+			if result.State == state {
+				value = 1
+			}
+			fmt.Fprintf(&b, "pinggo_device_state{device=%q,ip=%q,state=%q} %d\n", result.Description, result.IP, state, value)
+		}
+	}
+
+	b.WriteString("# HELP pinggo_device_reachable Whether the last probe of the device got an answer.\n")
+	b.WriteString("# TYPE pinggo_device_reachable gauge\n")
+	for _, result := range snapshot.Results {
+		value := 0
+		if result.Reachable {
+			value = 1
+		}
+		fmt.Fprintf(&b, "pinggo_device_reachable{device=%q,ip=%q} %d\n", result.Description, result.IP, value)
+	}
+
+	b.WriteString("# HELP pinggo_device_rtt_seconds Average round trip time of the last probe.\n")
+	b.WriteString("# TYPE pinggo_device_rtt_seconds gauge\n")
+	for _, result := range snapshot.Results {
+		if result.Reachable {
+			fmt.Fprintf(&b, "pinggo_device_rtt_seconds{device=%q,ip=%q} %g\n", result.Description, result.IP, result.RTTMillis/1000)
+		}
+	}
+
+	queueDepth := 0
+	if m.digest != nil {
+		queueDepth = m.digest.Pending()
+	}
+	writeSelfMetrics(&b, queueDepth)
+	if m.pacer != nil {
+		m.pacer.writeMetrics(&b)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
+
+func writeJSON(w http.ResponseWriter, payload interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		fmt.Printf("Error writing API response: %v\n", err)
+	}
+}
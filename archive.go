@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArchiveConfig describes the S3-compatible bucket check results are archived to
+type ArchiveConfig struct {
+	Endpoint string   `yaml:"endpoint"` // e.g. "https://s3.eu-central-1.amazonaws.com" or a MinIO URL
+	Region   string   `yaml:"region"`
+	Bucket   string   `yaml:"bucket"`
+	Prefix   string   `yaml:"prefix"`
+	Interval Duration `yaml:"interval"` // How often to upload (default 1h)
+}
+
+// archivedResult is one line of the results NDJSON
+type archivedResult struct {
+	Time time.Time `json:"time"`
+	DeviceResult
+}
+
+// archiver buffers check results and status changes and uploads them as gzipped NDJSON
+type archiver struct {
+	config    *ArchiveConfig
+	accessKey string
+	secretKey string
+
+	mu         sync.Mutex
+	results    []byte // NDJSON of archivedResult
+	incidents  []byte // NDJSON of StatusChange
+	throughput []byte // NDJSON of ThroughputResult
+	notes      []byte // NDJSON of DeviceNote
+}
+
+// newArchiver creates an archiver using the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables
+func newArchiver(config *ArchiveConfig) (*archiver, error) {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID or AWS_SECRET_ACCESS_KEY is missing in the environment variables")
+	}
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("archive endpoint and bucket are required")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	return &archiver{config: config, accessKey: accessKey, secretKey: secretKey}, nil
+}
+
+// Record buffers the results and status changes of a completed cycle until the next upload
+func (a *archiver) Record(snapshot CycleSnapshot, changes []StatusChange) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, result := range snapshot.Results {
+		a.results = appendNDJSON(a.results, archivedResult{Time: snapshot.Time, DeviceResult: result})
+	}
+	for _, change := range changes {
+		a.incidents = appendNDJSON(a.incidents, change)
+	}
+	return nil
+}
+
+// RecordThroughput buffers a speed test result until the next upload
+func (a *archiver) RecordThroughput(result ThroughputResult) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.throughput = appendNDJSON(a.throughput, result)
+	return nil
+}
+
+// RecordNote buffers an operator note until the next upload
+func (a *archiver) RecordNote(note DeviceNote) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.notes = appendNDJSON(a.notes, note)
+	return nil
+}
+
+// appendNDJSON appends record to buf as a single JSON line
+func appendNDJSON(buf []byte, record interface{}) []byte {
+	line, err := json.Marshal(record)
+	if err != nil {
+		fmt.Printf("Error encoding archive record: %v\n", err)
+		return buf
+	}
+	return append(append(buf, line...), '\n')
+}
+
+// Run uploads the buffered records every interval
+func (a *archiver) Run() {
+	interval := a.config.Interval.Duration()
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	for range time.Tick(interval) {
+		a.flush()
+	}
+}
+
+// flush uploads everything buffered so far; records are kept for the next attempt if an upload fails
+func (a *archiver) flush() {
+	a.mu.Lock()
+	results, incidents, throughput, notes := a.results, a.incidents, a.throughput, a.notes
+	a.results, a.incidents, a.throughput, a.notes = nil, nil, nil, nil
+	a.mu.Unlock()
+
+	now := time.Now().UTC()
+	if len(results) > 0 {
+		if err := a.upload(a.key("results", now), results); err != nil {
+			fmt.Printf("Error archiving check results: %v\n", err)
+			a.mu.Lock()
+			a.results = append(results, a.results...)
+			a.mu.Unlock()
+		}
+	}
+	if len(incidents) > 0 {
+		if err := a.upload(a.key("incidents", now), incidents); err != nil {
+			fmt.Printf("Error archiving incident log: %v\n", err)
+			a.mu.Lock()
+			a.incidents = append(incidents, a.incidents...)
+			a.mu.Unlock()
+		}
+	}
+	if len(throughput) > 0 {
+		if err := a.upload(a.key("throughput", now), throughput); err != nil {
+			fmt.Printf("Error archiving speed tests: %v\n", err)
+			a.mu.Lock()
+			a.throughput = append(throughput, a.throughput...)
+			a.mu.Unlock()
+		}
+	}
+	if len(notes) > 0 {
+		if err := a.upload(a.key("notes", now), notes); err != nil {
+			fmt.Printf("Error archiving notes: %v\n", err)
+			a.mu.Lock()
+			a.notes = append(notes, a.notes...)
+			a.mu.Unlock()
+		}
+	}
+}
+
+// key builds a date-partitioned object key, e.g. "prefix/results/2024/08/31/20240831T120000Z.ndjson.gz"
+func (a *archiver) key(kind string, t time.Time) string {
+	parts := []string{kind, t.Format("2006/01/02"), t.Format("20060102T150405Z") + ".ndjson.gz"}
+	if prefix := strings.Trim(a.config.Prefix, "/"); prefix != "" {
+		parts = append([]string{prefix}, parts...)
+	}
+	return strings.Join(parts, "/")
+}
+
+// upload gzips the NDJSON records and PUTs them to the bucket
+func (a *archiver) upload(key string, ndjson []byte) error {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(ndjson); err != nil {
+		return fmt.Errorf("could not compress records: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("could not compress records: %w", err)
+	}
+
+	return a.putObject(key, buf.Bytes())
+}
+
+// putObject uploads body to the bucket using a path-style URL and AWS Signature Version 4
+func (a *archiver) putObject(key string, body []byte) error {
+	endpoint, err := url.Parse(strings.TrimSuffix(a.config.Endpoint, "/"))
+	if err != nil {
+		return fmt.Errorf("invalid archive endpoint: %w", err)
+	}
+	path := "/" + a.config.Bucket + "/" + key
+
+	req, err := http.NewRequest(http.MethodPut, endpoint.Scheme+"://"+endpoint.Host+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("Content-Encoding", "gzip")
+	a.sign(req, path, body, time.Now().UTC())
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not upload %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status code %d uploading %s: %s", resp.StatusCode, key, msg)
+	}
+	return nil
+}
+
+// sign adds the AWS Signature Version 4 headers to req
+func (a *archiver) sign(req *http.Request, path string, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-encoding;content-type;host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		"",
+		"content-encoding:" + req.Header.Get("Content-Encoding"),
+		"content-type:" + req.Header.Get("Content-Type"),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + amzDate,
+		"",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + a.config.Region + "/s3/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+a.secretKey), date)
+	key = hmacSHA256(key, a.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Blackout is a one-off maintenance period registered at runtime for a group or a single device
+type Blackout struct {
+	ID     string    `json:"id" yaml:"id"`
+	Group  string    `json:"group,omitempty" yaml:"group,omitempty"`
+	Device string    `json:"device,omitempty" yaml:"device,omitempty"` // Description or IP
+	Reason string    `json:"reason" yaml:"reason"`
+	From   time.Time `json:"from" yaml:"from"`
+	Until  time.Time `json:"until" yaml:"until"`
+	By     string    `json:"by,omitempty" yaml:"by,omitempty"`
+}
+
+// Covers reports whether the blackout applies to the device at time t
+func (b Blackout) Covers(device Device, t time.Time) bool {
+	if t.Before(b.From) || !t.Before(b.Until) {
+		return false
+	}
+	if b.Group != "" && b.Group == device.Group {
+		return true
+	}
+	return b.Device != "" && (b.Device == device.IP || strings.EqualFold(b.Device, device.Description))
+}
+
+// Target describes what the blackout applies to
+func (b Blackout) Target() string {
+	if b.Group != "" {
+		return "group " + b.Group
+	}
+	return b.Device
+}
+
+// pruneBlackouts drops blackouts that have ended
+func pruneBlackouts(blackouts []Blackout, now time.Time) []Blackout {
+	active := blackouts[:0]
+	for _, blackout := range blackouts {
+		if now.Before(blackout.Until) {
+			active = append(active, blackout)
+		}
+	}
+	return active
+}
+
+type blackoutOptions struct {
+	group, device, duration, reason string
+}
+
+func (o *blackoutOptions) flags(fs *flag.FlagSet) {
+	fs.StringVar(&o.group, "group", "", "`group` to black out")
+	fs.StringVar(&o.device, "device", "", "description or IP of a single `device` to black out")
+	fs.StringVar(&o.duration, "for", "1h", "how long the blackout lasts, e.g. 30m, 4h, 2d")
+	fs.StringVar(&o.reason, "reason", "", "why, shown with the blackout")
+}
+
+// runBlackoutCommand implements "ping_monitor blackout [--group g | --device d] --for 4h --reason text",
+// "blackout list" and "blackout cancel <id>"
+func runBlackoutCommand(config *Config, state stateStore, args []string) error {
+	if len(args) > 0 && args[0] == "list" {
+		blackouts, err := state.Blackouts()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("| %-8s | %-20s | %-16s | %-16s | %s\n", "ID", "Target", "From", "Until", "Reason")
+		fmt.Println("|----------|----------------------|------------------|------------------|--------")
+		for _, b := range blackouts {
+			fmt.Printf("| %-8s | %-20s | %-16s | %-16s | %s\n", b.ID, b.Target(),
+				b.From.Local().Format("2006-01-02 15:04"), b.Until.Local().Format("2006-01-02 15:04"), b.Reason)
+		}
+		return nil
+	}
+	if len(args) > 0 && args[0] == "cancel" {
+		if len(args) != 2 {
+			return fmt.Errorf("usage: blackout cancel <id>")
+		}
+		if err := state.DeleteBlackout(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Cancelled blackout %s\n", args[1])
+		return nil
+	}
+
+	var options blackoutOptions
+	fs := flag.NewFlagSet("blackout", flag.ExitOnError)
+	options.flags(fs)
+	fs.Parse(args)
+
+	if (options.group == "") == (options.device == "") {
+		return fmt.Errorf("exactly one of --group or --device is required")
+	}
+	// A typo would otherwise create a blackout that silently covers nothing. The check sees the devices of
+	// the config file, imported ones included, and of the DNS zone, like the running monitor.
+	devices := configuredDevices(config)
+	unknown := ""
+	if options.group != "" && !config.hasGroup(options.group, devices) {
+		unknown = fmt.Sprintf("unknown group %q", options.group)
+	}
+	if _, ok := findDevice(devices, options.device); options.device != "" && !ok {
+		unknown = fmt.Sprintf("unknown device %q, expected the IP or description of a monitored device", options.device)
+	}
+	if unknown != "" {
+		// A zone that cannot be transferred from here may still hold the device
+		if config.DNSSync == nil {
+			return fmt.Errorf("%s", unknown)
+		}
+		fmt.Printf("Warning: %s, creating the blackout anyway\n", unknown)
+	}
+	length, err := parseWindow(options.duration)
+	if err != nil {
+		return err
+	}
+
+	blackout, err := newBlackout(options.group, options.device, options.reason, length, os.Getenv("USER"))
+	if err != nil {
+		return err
+	}
+	if err := state.AddBlackout(blackout); err != nil {
+		return err
+	}
+	fmt.Printf("Blackout %s: %s in maintenance until %s\n", blackout.ID, blackout.Target(), blackout.Until.Local().Format("2006-01-02 15:04"))
+	return nil
+}
+
+// hasGroup reports whether a group is configured in groups or used by one of the devices
+func (c *Config) hasGroup(name string, devices []Device) bool {
+	if _, ok := c.Groups[name]; ok {
+		return true
+	}
+	for _, device := range devices {
+		if device.Group == name {
+			return true
+		}
+	}
+	return false
+}
+
+// newBlackout creates a blackout starting now
+func newBlackout(group, device, reason string, length time.Duration, by string) (Blackout, error) {
+	id := make([]byte, 4)
+	if _, err := rand.Read(id); err != nil {
+		return Blackout{}, fmt.Errorf("could not generate blackout id: %w", err)
+	}
+	now := time.Now().UTC()
+	return Blackout{
+		ID:     hex.EncodeToString(id),
+		Group:  group,
+		Device: device,
+		Reason: reason,
+		From:   now,
+		Until:  now.Add(length),
+		By:     by,
+	}, nil
+}
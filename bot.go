@@ -0,0 +1,324 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// telegramUpdate is one entry returned by the getUpdates Bot API method
+type telegramUpdate struct {
+	UpdateID int                      `json:"update_id"`
+	Message  *telegramIncomingMessage `json:"message"`
+}
+
+type telegramIncomingMessage struct {
+	MessageID int           `json:"message_id"`
+	From      *telegramUser `json:"from"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Text string `json:"text"`
+
+	ReplyToMessage *telegramIncomingMessage `json:"reply_to_message"`
+}
+
+type telegramUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username,omitempty"`
+	FirstName string `json:"first_name,omitempty"`
+	IsBot     bool   `json:"is_bot,omitempty"`
+}
+
+// pollTelegramCommands long-polls the Bot API for messages and answers the commands in them
+func (m *monitor) pollTelegramCommands() {
+	// Replies are only notes when they answer this bot, other bots in the chat may post alerts too
+	var self *telegramUser
+	for {
+		var err error
+		if self, err = getTelegramMe(m.botToken); err == nil {
+			break
+		}
+		fmt.Printf("Error identifying the Telegram bot: %v\n", err)
+		time.Sleep(10 * time.Second)
+	}
+
+	offset := 0
+	for {
+		updates, err := getTelegramUpdates(m.botToken, offset)
+		if err != nil {
+			fmt.Printf("Error polling Telegram updates: %v\n", err)
+			time.Sleep(10 * time.Second)
+			continue
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+			msg := update.Message
+			if msg == nil {
+				continue
+			}
+			// Replies to the bot's alerts become notes on the device
+			isReply := msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil && msg.ReplyToMessage.From.ID == self.ID &&
+				!strings.HasPrefix(msg.Text, "/")
+			if !isReply && !strings.HasPrefix(msg.Text, "/") {
+				continue
+			}
+			chatID := strconv.FormatInt(msg.Chat.ID, 10)
+			allowed := m.authorized(msg.From)
+			if chatID != m.chatID && !(allowed && len(m.config.TelegramAllowedUsers) > 0) {
+				// Not answered, so strangers cannot probe for the bot, but logged to debug the allowlist
+				fmt.Printf("Ignored Telegram command %q from %s in chat %s, which is not the configured chat\n", msg.Text, describeUser(msg.From), chatID)
+				continue
+			}
+			if !allowed {
+				fmt.Printf("Rejected Telegram command %q from unauthorized user %s\n", msg.Text, describeUser(msg.From))
+				if err := sendTelegramMessage(m.botToken, chatID, "⛔ You are not authorized to use this command."); err != nil {
+					fmt.Printf("Error answering Telegram command: %v\n", err)
+				}
+				continue
+			}
+
+			var reply string
+			if isReply {
+				reply = m.noteReply(msg.ReplyToMessage.Text, msg.Text, describeUser(msg.From))
+			} else {
+				reply = m.handleCommand(msg.Text, describeUser(msg.From))
+			}
+			if reply == "" {
+				continue
+			}
+			if err := sendTelegramMessage(m.botToken, chatID, reply); err != nil {
+				fmt.Printf("Error answering Telegram command: %v\n", err)
+			}
+			if isReply {
+				continue
+			}
+			chart, err := m.reportChart(msg.Text)
+			if err != nil {
+				fmt.Printf("Error rendering uptime chart: %v\n", err)
+			} else if chart != nil {
+				if err := sendTelegramPhoto(m.botToken, chatID, "Uptime chart", chart); err != nil {
+					fmt.Printf("Error sending uptime chart: %v\n", err)
+				}
+			}
+		}
+	}
+}
+
+// authorized reports whether the user may run bot commands. Without an allowlist everyone in the
+// configured chat may; with one, only the listed user IDs or @usernames may, in any chat with the bot.
+func (m *monitor) authorized(user *telegramUser) bool {
+	if len(m.config.TelegramAllowedUsers) == 0 {
+		return true
+	}
+	if user == nil {
+		return false
+	}
+	for _, allowed := range m.config.TelegramAllowedUsers {
+		if allowed == strconv.FormatInt(user.ID, 10) ||
+			(user.Username != "" && strings.EqualFold(strings.TrimPrefix(allowed, "@"), user.Username)) {
+			return true
+		}
+	}
+	return false
+}
+
+func describeUser(user *telegramUser) string {
+	if user == nil {
+		return "unknown"
+	}
+	if user.Username != "" {
+		return fmt.Sprintf("@%s (%d)", user.Username, user.ID)
+	}
+	return strconv.FormatInt(user.ID, 10)
+}
+
+// handleCommand executes a bot command such as "/report 7d" for author and returns the reply
+func (m *monitor) handleCommand(text, author string) string {
+	fields := strings.Fields(text)
+	// Commands in group chats may be addressed as /report@SomeBot
+	command := strings.SplitN(fields[0], "@", 2)[0]
+	args := fields[1:]
+
+	switch command {
+	case "/report":
+		query, err := parseReportArgs(args, m.reportGroups())
+		if err != nil {
+			return err.Error()
+		}
+		now := time.Now()
+		return formatReport(m.uptime.Summary(query.Window, query.Group, now), m.groupIncidents(now.Add(-query.Window), query.Group),
+			m.Devices(), query.Window, query.Group)
+	case "/ping":
+		if len(args) == 0 {
+			return "Usage: /ping <ip or description>"
+		}
+		return m.pingCommand(strings.Join(args, " "))
+	case "/status":
+		return m.statusCommand()
+	case "/mute":
+		return m.muteCommand(args)
+	case "/unmute":
+		return m.unmuteCommand(args)
+	case "/oncall":
+		return m.onCallCommand()
+	case "/note":
+		return m.noteCommand(args, author)
+	case "/incidents":
+		return m.incidentsCommand()
+	case "/ack":
+		return m.ackCommand(args, author)
+	case "/help", "/start":
+		return "Commands:\n" +
+			"/status - current state of all devices\n" +
+			"/report [24h|7d] [group] [chart] - uptime and incident summary, optionally as an image too\n" +
+			"/ping <ip or description> - probe a device right now\n" +
+			"/mute <ip or description> [duration] - silence a device (default 1h)\n" +
+			"/unmute <ip or description> - end a mute\n" +
+			"/oncall - who is on call in each group\n" +
+			"/note <ip or description> <text> - annotate a device, or reply to an alert\n" +
+			"/incidents - incidents of the last 24 hours\n" +
+			"/ack [incident] - acknowledge the open incident and stop its escalation"
+	}
+	return ""
+}
+
+// statusCommand lists the state of every device from the last completed cycle
+func (m *monitor) statusCommand() string {
+	m.mu.Lock()
+	snapshot := m.lastSnapshot
+	m.mu.Unlock()
+
+	if len(snapshot.Results) == 0 {
+		return "No results yet, the first cycle is still running."
+	}
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("Status at %s\n\n", snapshot.Time.Format("15:04:05")))
+	for _, result := range snapshot.Results {
+		b.WriteString(fmt.Sprintf("%s %s (%s): %s\n", result.State.Emoji(), result.Description, result.IP, result.State))
+	}
+	return b.String()
+}
+
+// muteCommand silences a device for a while; it is still probed and shown as muted
+func (m *monitor) muteCommand(args []string) string {
+	duration, target, err := parseMuteDuration(args)
+	if err != nil {
+		return err.Error()
+	}
+	device, ok := findDevice(m.Devices(), strings.Join(target, " "))
+	if !ok {
+		return fmt.Sprintf("Unknown device %q", strings.Join(target, " "))
+	}
+	until := time.Now().Add(duration)
+	if err := m.state.Mute(device.IP, until); err != nil {
+		return fmt.Sprintf("Could not mute %s: %v", device.Description, err)
+	}
+	return fmt.Sprintf("🔕 %s muted until %s", device.Description, until.Format("2006-01-02 15:04"))
+}
+
+func (m *monitor) unmuteCommand(args []string) string {
+	device, ok := findDevice(m.Devices(), strings.Join(args, " "))
+	if !ok {
+		return fmt.Sprintf("Unknown device %q", strings.Join(args, " "))
+	}
+	if err := m.state.Mute(device.IP, time.Time{}); err != nil {
+		return fmt.Sprintf("Could not unmute %s: %v", device.Description, err)
+	}
+	return fmt.Sprintf("🔔 %s unmuted", device.Description)
+}
+
+// parseMuteDuration reads the optional duration of a mute command, defaulting to one hour
+func parseMuteDuration(args []string) (time.Duration, []string, error) {
+	if len(args) > 1 {
+		if d, err := parseWindow(args[len(args)-1]); err == nil {
+			return d, args[:len(args)-1], nil
+		}
+	}
+	if len(args) == 0 {
+		return 0, nil, fmt.Errorf("usage: /mute <ip or description> [duration]")
+	}
+	return time.Hour, args, nil
+}
+
+// pingCommand probes a configured device, matched by IP or description, or any other host right away
+func (m *monitor) pingCommand(target string) string {
+	device, ok := findDevice(m.Devices(), target)
+	if !ok {
+		device = Device{Description: target, IP: target}
+	}
+
+	name := device.IP
+	if device.Description != device.IP {
+		name = fmt.Sprintf("%s (%s)", device.Description, device.IP)
+	}
+
+	stats, err := probeDevice(device)
+	if err != nil {
+		return fmt.Sprintf("❓ %s: ping failed: %v", name, err)
+	}
+	state := probeState(device, stats, nil)
+	if state == StateDown {
+		return fmt.Sprintf("%s %s is down, 0/%d replies", state.Emoji(), name, stats.PacketsSent)
+	}
+	return fmt.Sprintf("%s %s is %s, %d/%d replies, RTT min/avg/max %s/%s/%s", state.Emoji(), name, state,
+		stats.PacketsRecv, stats.PacketsSent, roundRTT(stats.MinRtt), roundRTT(stats.AvgRtt), roundRTT(stats.MaxRtt))
+}
+
+func roundRTT(d time.Duration) time.Duration {
+	return d.Round(10 * time.Microsecond)
+}
+
+// getTelegramMe returns the bot's own user, as reported by the getMe Bot API method
+func getTelegramMe(botToken string) (*telegramUser, error) {
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("https://api.telegram.org/bot%s/getMe", botToken))
+	if err != nil {
+		return nil, fmt.Errorf("could not get bot user from Telegram: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result telegramUser `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("could not decode bot user: %w", err)
+	}
+	return &result.Result, nil
+}
+
+// getTelegramUpdates waits up to 50 seconds for new updates starting at offset
+func getTelegramUpdates(botToken string, offset int) ([]telegramUpdate, error) {
+	params := url.Values{}
+	params.Set("offset", strconv.Itoa(offset))
+	params.Set("timeout", "50")
+	params.Set("allowed_updates", `["message"]`)
+
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Get(fmt.Sprintf("https://api.telegram.org/bot%s/getUpdates?%s", botToken, params.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("could not get updates from Telegram: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Result []telegramUpdate `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("could not decode updates: %w", err)
+	}
+	return result.Result, nil
+}
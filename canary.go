@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// CanaryConfig rolls out changed device settings to a share of the devices first. Once the canaries went
+// through enough cycles without an alert the change is promoted to all devices, otherwise it is rolled back.
+type CanaryConfig struct {
+	Percent float64 `yaml:"percent"` // Share of the changed devices getting the new settings first, default 10
+	Cycles  int     `yaml:"cycles"`  // Clean cycles before the change is promoted, default 5
+}
+
+// canaryRollout is a reload applied to the canary devices only
+type canaryRollout struct {
+	previous []Device        // Device list before the reload
+	updated  []Device        // Device list of the new config
+	devices  map[string]bool // IPs of the devices running the new settings
+	clean    int             // Cycles completed without an alert from a canary
+}
+
+// startCanary picks the canaries among the devices whose settings changed and returns the device list to
+// run during the rollout: new settings for the canaries, the previous ones for the other changed devices.
+// Added and removed devices take effect right away. Returns nil if no device changed.
+func startCanary(config *CanaryConfig, previous, updated []Device) (*canaryRollout, []Device) {
+	before := make(map[string]Device, len(previous))
+	for _, device := range previous {
+		before[device.IP] = device
+	}
+	var changed []string
+	for _, device := range updated {
+		if old, ok := before[device.IP]; ok && len(changedFields(old, device)) > 0 {
+			changed = append(changed, device.IP)
+		}
+	}
+	if len(changed) == 0 {
+		return nil, updated
+	}
+
+	percent := config.Percent
+	if percent <= 0 {
+		percent = 10
+	}
+	// Hashing keeps the choice stable, so the same devices are the canaries when a config is reloaded twice
+	sort.Slice(changed, func(i, j int) bool { return hashKey(changed[i]) < hashKey(changed[j]) })
+	count := int(float64(len(changed)) * percent / 100)
+	if count < 1 {
+		count = 1
+	}
+	rollout := &canaryRollout{previous: previous, updated: updated, devices: make(map[string]bool, count)}
+	for _, ip := range changed[:count] {
+		rollout.devices[ip] = true
+	}
+
+	devices := make([]Device, len(updated))
+	for i, device := range updated {
+		if old, ok := before[device.IP]; ok && !rollout.devices[device.IP] {
+			device = old
+		}
+		devices[i] = device
+	}
+	return rollout, devices
+}
+
+// rolledBack returns the device list of the new config with the previous settings of every changed device
+// restored. Devices added or removed by the reload stay added or removed.
+func (r *canaryRollout) rolledBack() []Device {
+	before := make(map[string]Device, len(r.previous))
+	for _, device := range r.previous {
+		before[device.IP] = device
+	}
+	devices := make([]Device, len(r.updated))
+	for i, device := range r.updated {
+		if old, ok := before[device.IP]; ok {
+			device = old
+		}
+		devices[i] = device
+	}
+	return devices
+}
+
+// checkCanary counts a completed cycle towards the rollout in progress. A canary entering an alerting state
+// rolls the reload back; after enough clean cycles it is promoted to all devices.
+func (m *monitor) checkCanary(changes []StatusChange) {
+	m.mu.Lock()
+	rollout := m.canary
+	if rollout == nil {
+		m.mu.Unlock()
+		return
+	}
+
+	var failed []string
+	for _, change := range changes {
+		if rollout.devices[change.IP] && (change.State == StateDown || change.State == StateDegraded || change.State == StateFlapping) {
+			failed = append(failed, fmt.Sprintf("%s (%s) is %s", change.Description, change.IP, change.State))
+		}
+	}
+	if len(failed) > 0 {
+		m.configured = rollout.rolledBack()
+		m.canary = nil
+		m.mu.Unlock()
+		message := fmt.Sprintf("↩️ Config canary rolled back, %d canary devices alerted:\n", len(failed))
+		for _, line := range failed {
+			message += line + "\n"
+		}
+		fmt.Print(message)
+		m.notifyReload(message)
+		return
+	}
+
+	rollout.clean++
+	cycles := m.config.Reload.Canary.Cycles
+	if cycles <= 0 {
+		cycles = 5
+	}
+	if rollout.clean < cycles {
+		m.mu.Unlock()
+		return
+	}
+	m.configured = rollout.updated
+	m.canary = nil
+	m.mu.Unlock()
+	message := fmt.Sprintf("✅ Config canary promoted to all devices after %d clean cycles\n", rollout.clean)
+	fmt.Print(message)
+	m.notifyReload(message)
+}
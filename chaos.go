@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// ChaosConfig injects failures and latency into the probe results of selected devices, so alert routing,
+// escalations and the dashboard can be rehearsed in staging. It must end at a fixed time, so a forgotten
+// experiment cannot keep faking outages.
+type ChaosConfig struct {
+	Until string      `yaml:"until"` // Local end time, "2026-10-16 18:00"; required
+	Rules []ChaosRule `yaml:"rules"`
+
+	until time.Time
+}
+
+// ChaosRule selects devices by group or by description or IP, like a blackout
+type ChaosRule struct {
+	Group          string   `yaml:"group"`
+	Device         string   `yaml:"device"`
+	FailurePercent float64  `yaml:"failure_percent"` // Share of the checks reported as lost
+	Latency        Duration `yaml:"latency"`         // Added to the RTT of the checks picked by latency_percent
+	LatencyPercent float64  `yaml:"latency_percent"` // Default 100 when latency is set
+}
+
+// parse validates the experiment and remembers its end
+func (c *ChaosConfig) parse(now time.Time) error {
+	until, err := time.ParseInLocation(onCallLayout, c.Until, time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid until %q, expected YYYY-MM-DD HH:MM", c.Until)
+	}
+	c.until = until
+	for i, rule := range c.Rules {
+		if (rule.Group == "") == (rule.Device == "") {
+			return fmt.Errorf("rule %d needs exactly one of group or device", i+1)
+		}
+		if rule.FailurePercent < 0 || rule.FailurePercent > 100 || rule.LatencyPercent < 0 || rule.LatencyPercent > 100 {
+			return fmt.Errorf("rule %d: percentages must be between 0 and 100", i+1)
+		}
+	}
+	if c.Active(now) {
+		fmt.Printf("Warning: chaos injection is active until %s, probe results of %d rules are faked\n", c.until.Format(onCallLayout), len(c.Rules))
+	}
+	return nil
+}
+
+// Active reports whether the experiment is still running
+func (c *ChaosConfig) Active(now time.Time) bool {
+	return c != nil && now.Before(c.until)
+}
+
+func (r ChaosRule) matches(device Device) bool {
+	if r.Group != "" {
+		return r.Group == device.Group
+	}
+	return r.Device == device.IP || strings.EqualFold(r.Device, device.Description)
+}
+
+// Apply returns the probe result with the failures and latency of the matching rules injected, and whether
+// a failure was injected. The result is copied, devices sharing a probe are not affected.
+func (c *ChaosConfig) Apply(device Device, stats *ping.Statistics, now time.Time) (*ping.Statistics, bool) {
+	if !c.Active(now) {
+		return stats, false
+	}
+	for _, rule := range c.Rules {
+		if !rule.matches(device) {
+			continue
+		}
+		if rand.Float64()*100 < rule.FailurePercent {
+			fmt.Printf("Chaos: %s (%s) reported unreachable\n", device.Description, device.IP)
+			lost := &ping.Statistics{Addr: device.IP, PacketLoss: 100}
+			if stats != nil {
+				lost.PacketsSent = stats.PacketsSent
+			}
+			return lost, true
+		}
+		percent := rule.LatencyPercent
+		if percent == 0 {
+			percent = 100
+		}
+		if latency := rule.Latency.Duration(); latency > 0 && stats != nil && stats.PacketsRecv > 0 && rand.Float64()*100 < percent {
+			fmt.Printf("Chaos: %s (%s) delayed by %s\n", device.Description, device.IP, latency)
+			delayed := *stats
+			delayed.MinRtt += latency
+			delayed.MaxRtt += latency
+			delayed.AvgRtt += latency
+			stats = &delayed
+		}
+	}
+	return stats, false
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ChatConfig connects a Mattermost or Rocket.Chat channel: alerts are posted to an incoming webhook,
+// and a slash command or outgoing webhook pointed at /chatops/<name> runs bot commands
+type ChatConfig struct {
+	Name          string `yaml:"name"`            // Channel name for escalation policies and the command URL
+	Platform      string `yaml:"platform"`        // "mattermost" or "rocketchat"
+	WebhookURL    string `yaml:"webhook_url"`     // Incoming webhook
+	WebhookURLEnv string `yaml:"webhook_url_env"` // Environment variable holding the webhook URL, instead of WebhookURL
+	TokenEnv      string `yaml:"token_env"`       // Environment variable holding the slash command or outgoing webhook token
+	MinSeverity   string `yaml:"min_severity"`
+}
+
+// validateChats checks the chat configuration before the monitor starts
+func validateChats(chats []ChatConfig) error {
+	names := make(map[string]bool)
+	for _, chat := range chats {
+		if chat.Platform != "mattermost" && chat.Platform != "rocketchat" {
+			return fmt.Errorf("chat %s: unsupported platform %q", chat.Name, chat.Platform)
+		}
+		if chat.Name == "" || names[chat.Name] {
+			return fmt.Errorf("every chat needs a unique name")
+		}
+		names[chat.Name] = true
+		if chat.webhookURL() == "" {
+			return fmt.Errorf("chat %s: webhook_url or webhook_url_env is required", chat.Name)
+		}
+		if !validSeverity(chat.MinSeverity) {
+			return fmt.Errorf("chat %s: unknown min_severity %q", chat.Name, chat.MinSeverity)
+		}
+	}
+	return nil
+}
+
+func (c ChatConfig) webhookURL() string {
+	if c.WebhookURLEnv != "" {
+		return os.Getenv(c.WebhookURLEnv)
+	}
+	return c.WebhookURL
+}
+
+// post sends a message to the incoming webhook; both platforms accept {"text": ...}
+func (c ChatConfig) post(text string) error {
+	jsonData, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return fmt.Errorf("could not encode message to JSON: %w", err)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(c.webhookURL(), "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("could not send message to %s: %w", c.Platform, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sendChats posts the status changes and alerts of a cycle to every chat
+func (m *monitor) sendChats(changes []StatusChange, uplinkMessage string, alerts []string, devices []Device, results []DeviceResult) {
+	for _, chat := range m.config.Chats {
+		chatChanges := filterSeverity(changes, devices, chat.MinSeverity)
+		if len(chatChanges) == 0 && len(alerts) == 0 && uplinkMessage == "" {
+			continue
+		}
+
+		text := uplinkMessage + formatStatusChanges(chatChanges, devices, results)
+		for _, alert := range alerts {
+			text += alert + "\n"
+		}
+		if err := recordDelivery(chat.Name, chat.post(text)); err != nil {
+			fmt.Printf("Error sending %s message: %v\n", chat.Platform, err)
+			continue
+		}
+		for _, change := range chatChanges {
+			m.incidents.Notified(change.IP, chat.Name, time.Now())
+		}
+	}
+}
+
+// handleChatOps answers a Mattermost slash command or a Mattermost/Rocket.Chat outgoing webhook with
+// the bot commands known from Telegram, e.g. "/monitor status", "status" or "!mute 10.0.0.5 1h"
+func (m *monitor) handleChatOps(w http.ResponseWriter, r *http.Request) {
+	var chat *ChatConfig
+	for i := range m.config.Chats {
+		if "/chatops/"+m.config.Chats[i].Name == r.URL.Path {
+			chat = &m.config.Chats[i]
+		}
+	}
+	if chat == nil || r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Slash commands and Mattermost outgoing webhooks post forms, Rocket.Chat posts JSON
+	var request struct {
+		Token       string `json:"token"`
+		Text        string `json:"text"`
+		UserName    string `json:"user_name"`
+		TriggerWord string `json:"trigger_word"`
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		request.Token = r.PostForm.Get("token")
+		request.Text = r.PostForm.Get("text")
+		request.UserName = r.PostForm.Get("user_name")
+		request.TriggerWord = r.PostForm.Get("trigger_word")
+	}
+
+	expected := os.Getenv(chat.TokenEnv)
+	if chat.TokenEnv == "" || expected == "" || subtle.ConstantTimeCompare([]byte(request.Token), []byte(expected)) != 1 {
+		fmt.Printf("Rejected %s command from %s: invalid token\n", chat.Platform, request.UserName)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	text := strings.TrimSpace(strings.TrimPrefix(request.Text, request.TriggerWord))
+	text = strings.TrimLeft(text, "/!")
+	if text == "" {
+		text = "help"
+	}
+	reply := m.handleCommand("/"+text, request.UserName+" ("+chat.Platform+")")
+	if reply == "" {
+		reply = "Unknown command, try help"
+	}
+	writeJSON(w, map[string]string{"response_type": "in_channel", "text": reply})
+}
@@ -0,0 +1,373 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cliCommand is a subcommand of ping_monitor. The registry drives dispatch, the usage message, shell
+// completions and the man page, so a new command only needs an entry here.
+type cliCommand struct {
+	name        string
+	args        string   // Synopsis of the arguments, e.g. "<file>"
+	summary     string   // One line, shown in the usage message and completions
+	subcommands []string // Completed as the first argument
+	files       bool     // The argument is a file
+	flags       func(fs *flag.FlagSet)
+	run         func(env commandEnv, args []string) error // Nil for commands that run without a config
+}
+
+// commandEnv is what commands get from the monitor's startup
+type commandEnv struct {
+	config     *Config
+	configFile string
+	state      stateStore
+}
+
+var cliCommands = []cliCommand{
+	{
+		name:        "token",
+		args:        "create --name <name> [--scopes read,write] | list | revoke <id>",
+		summary:     "Manage API tokens",
+		subcommands: []string{"create", "list", "revoke"},
+		flags:       func(fs *flag.FlagSet) { new(tokenOptions).flags(fs) },
+		run:         func(env commandEnv, args []string) error { return runTokenCommand(env.state, args) },
+	},
+	{
+		name:        "blackout",
+		args:        "--group <group> | --device <device> [--for 1h] [--reason <text>] | list | cancel <id>",
+		summary:     "Suppress alerts for a group or device during maintenance",
+		subcommands: []string{"list", "cancel"},
+		flags:       func(fs *flag.FlagSet) { new(blackoutOptions).flags(fs) },
+		run:         func(env commandEnv, args []string) error { return runBlackoutCommand(env.config, env.state, args) },
+	},
+	{
+		name:    "discover",
+		args:    "[--duration 10s] [--group <group>]",
+		summary: "Find devices announcing themselves over mDNS and SSDP and add them to the config",
+		flags:   func(fs *flag.FlagSet) { new(discoverOptions).flags(fs) },
+		run: func(env commandEnv, args []string) error {
+			return runDiscoverCommand(env.config, env.configFile, args)
+		},
+	},
+	{
+		name:    "export",
+		args:    "[-o <file>]",
+		summary: "Write the devices, mutes and blackouts as YAML",
+		flags:   func(fs *flag.FlagSet) { new(exportOptions).flags(fs) },
+		run: func(env commandEnv, args []string) error {
+			return runExportCommand(env.config, env.state, args)
+		},
+	},
+	{
+		name:    "import",
+		args:    "<file>",
+		summary: "Add the devices of an export to the config and restore its mutes and blackouts",
+		files:   true,
+		run: func(env commandEnv, args []string) error {
+			return runImportCommand(env.config, env.configFile, env.state, args)
+		},
+	},
+	{
+		name:    "reload",
+		args:    "[--force]",
+		summary: "Make the running monitor reload the device list (other settings need a restart)",
+		flags:   func(fs *flag.FlagSet) { new(reloadOptions).flags(fs) },
+		run:     func(env commandEnv, args []string) error { return runReloadCommand(env.config, args) },
+	},
+	{
+		name:        "completion",
+		args:        "bash|zsh|fish",
+		summary:     "Print the shell completion script",
+		subcommands: []string{"bash", "zsh", "fish"},
+	},
+	{
+		name:    "man",
+		summary: "Print the man page",
+	},
+}
+
+// findCommand looks up a command of the registry by name
+func findCommand(name string) (cliCommand, bool) {
+	for _, command := range cliCommands {
+		if command.name == name {
+			return command, true
+		}
+	}
+	return cliCommand{}, false
+}
+
+// commandFlag is a flag as shown in completions and the man page
+type commandFlag struct {
+	name  string
+	value string // Name of the value, empty for boolean flags
+	usage string
+}
+
+func collectFlags(fs *flag.FlagSet) []commandFlag {
+	var flags []commandFlag
+	fs.VisitAll(func(f *flag.Flag) {
+		value, usage := flag.UnquoteUsage(f)
+		flags = append(flags, commandFlag{name: f.Name, value: value, usage: usage})
+	})
+	return flags
+}
+
+// commandFlags returns the flags of the command, sorted by name
+func (c cliCommand) commandFlags() []commandFlag {
+	if c.flags == nil {
+		return nil
+	}
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	c.flags(fs)
+	return collectFlags(fs)
+}
+
+// dash writes a flag the way the README does: -o, --name
+func (f commandFlag) dash() string {
+	if len(f.name) == 1 {
+		return "-" + f.name
+	}
+	return "--" + f.name
+}
+
+// printUsage lists the global flags and the commands
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: ping_monitor [flags]\n       ping_monitor <command> [arguments]\n\nFlags:\n")
+	for _, f := range collectFlags(flag.CommandLine) {
+		fmt.Fprintf(out, "  %-16s %s\n", strings.TrimSpace(f.dash()+" "+f.value), f.usage)
+	}
+	fmt.Fprintf(out, "\nCommands:\n")
+	for _, command := range cliCommands {
+		fmt.Fprintf(out, "  %-12s %s\n", command.name, command.summary)
+	}
+}
+
+// runCompletionCommand implements "ping_monitor completion bash|zsh|fish"
+func runCompletionCommand(w io.Writer, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: completion bash|zsh|fish")
+	}
+	switch args[0] {
+	case "bash":
+		writeBashCompletion(w)
+	case "zsh":
+		writeZshCompletion(w)
+	case "fish":
+		writeFishCompletion(w)
+	default:
+		return fmt.Errorf("unsupported shell %q, use bash, zsh or fish", args[0])
+	}
+	return nil
+}
+
+func flagWords(flags []commandFlag) []string {
+	words := make([]string, len(flags))
+	for i, f := range flags {
+		words[i] = f.dash()
+	}
+	return words
+}
+
+func writeBashCompletion(w io.Writer) {
+	var names []string
+	for _, command := range cliCommands {
+		names = append(names, command.name)
+	}
+	fmt.Fprintf(w, "# bash completion for ping_monitor, generated by \"ping_monitor completion bash\"\n")
+	fmt.Fprintf(w, "_ping_monitor() {\n")
+	fmt.Fprintf(w, "    local cur=\"${COMP_WORDS[COMP_CWORD]}\" command=\"\" word\n")
+	fmt.Fprintf(w, "    for word in \"${COMP_WORDS[@]:1:COMP_CWORD-1}\"; do\n")
+	fmt.Fprintf(w, "        case \"$word\" in\n")
+	fmt.Fprintf(w, "            %s) command=\"$word\"; break ;;\n", strings.Join(names, "|"))
+	fmt.Fprintf(w, "        esac\n")
+	fmt.Fprintf(w, "    done\n")
+	fmt.Fprintf(w, "    case \"$command\" in\n")
+	fmt.Fprintf(w, "        \"\") COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n",
+		strings.Join(append(names, flagWords(collectFlags(flag.CommandLine))...), " "))
+	for _, command := range cliCommands {
+		words := append(append([]string{}, command.subcommands...), flagWords(command.commandFlags())...)
+		if command.files {
+			fmt.Fprintf(w, "        %s) COMPREPLY=($(compgen -f -- \"$cur\")) ;;\n", command.name)
+		} else if len(words) > 0 {
+			fmt.Fprintf(w, "        %s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", command.name, strings.Join(words, " "))
+		}
+	}
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "}\n")
+	fmt.Fprintf(w, "complete -o default -F _ping_monitor ping_monitor\n")
+}
+
+// zshSpec writes a flag as an _arguments spec
+func zshSpec(f commandFlag) string {
+	escape := strings.NewReplacer("[", "\\[", "]", "\\]", ":", "\\:", "'", "'\\''")
+	spec := fmt.Sprintf("'%s[%s]", f.dash(), escape.Replace(f.usage))
+	if f.value != "" {
+		spec += ":" + f.value + ":"
+		if f.value == "file" {
+			spec += "_files"
+		}
+	}
+	return spec + "'"
+}
+
+func writeZshCompletion(w io.Writer) {
+	fmt.Fprintf(w, "#compdef ping_monitor\n")
+	fmt.Fprintf(w, "# zsh completion for ping_monitor, generated by \"ping_monitor completion zsh\"\n\n")
+	fmt.Fprintf(w, "_ping_monitor() {\n")
+	fmt.Fprintf(w, "    local -a commands\n")
+	fmt.Fprintf(w, "    commands=(\n")
+	for _, command := range cliCommands {
+		fmt.Fprintf(w, "        '%s:%s'\n", command.name, strings.ReplaceAll(command.summary, "'", "'\\''"))
+	}
+	fmt.Fprintf(w, "    )\n")
+	fmt.Fprintf(w, "    local state line\n")
+	fmt.Fprintf(w, "    _arguments -C \\\n")
+	for _, f := range collectFlags(flag.CommandLine) {
+		fmt.Fprintf(w, "        %s \\\n", zshSpec(f))
+	}
+	fmt.Fprintf(w, "        '1: :->command' \\\n")
+	fmt.Fprintf(w, "        '*:: :->args'\n")
+	fmt.Fprintf(w, "    case $state in\n")
+	fmt.Fprintf(w, "        command) _describe 'command' commands ;;\n")
+	fmt.Fprintf(w, "        args)\n")
+	fmt.Fprintf(w, "            case $line[1] in\n")
+	for _, command := range cliCommands {
+		var specs []string
+		if len(command.subcommands) > 0 {
+			specs = append(specs, fmt.Sprintf("'1:subcommand:(%s)'", strings.Join(command.subcommands, " ")))
+		}
+		if command.files {
+			specs = append(specs, "'1:file:_files'")
+		}
+		for _, f := range command.commandFlags() {
+			specs = append(specs, zshSpec(f))
+		}
+		if len(specs) > 0 {
+			fmt.Fprintf(w, "                %s) _arguments %s ;;\n", command.name, strings.Join(specs, " "))
+		}
+	}
+	fmt.Fprintf(w, "            esac ;;\n")
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "}\n\n")
+	fmt.Fprintf(w, "_ping_monitor \"$@\"\n")
+}
+
+// fishFlag writes the option part of a fish complete line
+func fishFlag(f commandFlag) string {
+	option := "-l " + f.name
+	if len(f.name) == 1 {
+		option = "-s " + f.name
+	}
+	if f.value != "" {
+		option += " -r"
+		if f.value == "file" {
+			option += " -F"
+		}
+	}
+	return fmt.Sprintf("%s -d %s", option, fishQuote(f.usage))
+}
+
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer("\\", "\\\\", "'", "\\'").Replace(s) + "'"
+}
+
+func writeFishCompletion(w io.Writer) {
+	fmt.Fprintf(w, "# fish completion for ping_monitor, generated by \"ping_monitor completion fish\"\n")
+	fmt.Fprintf(w, "complete -c ping_monitor -f\n")
+	for _, f := range collectFlags(flag.CommandLine) {
+		fmt.Fprintf(w, "complete -c ping_monitor -n __fish_use_subcommand %s\n", fishFlag(f))
+	}
+	for _, command := range cliCommands {
+		fmt.Fprintf(w, "complete -c ping_monitor -n __fish_use_subcommand -a %s -d %s\n", command.name, fishQuote(command.summary))
+	}
+	for _, command := range cliCommands {
+		condition := fmt.Sprintf("'__fish_seen_subcommand_from %s'", command.name)
+		if len(command.subcommands) > 0 {
+			fmt.Fprintf(w, "complete -c ping_monitor -n %s -a %s\n", condition, fishQuote(strings.Join(command.subcommands, " ")))
+		}
+		if command.files {
+			fmt.Fprintf(w, "complete -c ping_monitor -n %s -F\n", condition)
+		}
+		for _, f := range command.commandFlags() {
+			fmt.Fprintf(w, "complete -c ping_monitor -n %s %s\n", condition, fishFlag(f))
+		}
+	}
+}
+
+// roff escapes text for the man page
+func roff(s string) string {
+	s = strings.NewReplacer("\\", "\\e", "-", "\\-").Replace(s)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = "\\&" + s
+	}
+	return s
+}
+
+func writeManFlags(w io.Writer, flags []commandFlag) {
+	for _, f := range flags {
+		fmt.Fprintf(w, ".TP\n\\fB%s\\fR", roff(f.dash()))
+		if f.value != "" {
+			fmt.Fprintf(w, " \\fI%s\\fR", roff(f.value))
+		}
+		fmt.Fprintf(w, "\n%s\n", roff(f.usage))
+	}
+}
+
+// runManCommand implements "ping_monitor man", e.g. ping_monitor man > /usr/local/share/man/man1/ping_monitor.1
+func runManCommand(w io.Writer) error {
+	date := time.Now().Format("2006-01-02")
+	if info := buildInfo(); len(info.BuildDate) >= 10 {
+		date = info.BuildDate[:10]
+	}
+	fmt.Fprintf(w, ".TH PING_MONITOR 1 %q %q \"User Commands\"\n", date, "ping_monitor "+version)
+	fmt.Fprintf(w, ".SH NAME\nping_monitor \\- monitor devices with pings and TCP probes and alert on state changes\n")
+	fmt.Fprintf(w, ".SH SYNOPSIS\n.B ping_monitor\n[\\fIflags\\fR]\n.br\n.B ping_monitor\n\\fIcommand\\fR [\\fIarguments\\fR]\n")
+	fmt.Fprintf(w, ".SH DESCRIPTION\n")
+	fmt.Fprintf(w, "Without a command, ping_monitor reads devices.yaml from the working directory and checks the devices in a loop, ")
+	fmt.Fprintf(w, "announcing state changes on the configured channels. The commands manage a monitor from the command line.\n")
+	fmt.Fprintf(w, ".SH OPTIONS\n")
+	writeManFlags(w, collectFlags(flag.CommandLine))
+	fmt.Fprintf(w, ".SH COMMANDS\n")
+	for _, command := range cliCommands {
+		fmt.Fprintf(w, ".TP\n\\fB%s\\fR %s\n%s\n", command.name, roff(command.args), roff(command.summary))
+		if flags := command.commandFlags(); len(flags) > 0 {
+			fmt.Fprintf(w, ".RS\n")
+			writeManFlags(w, flags)
+			fmt.Fprintf(w, ".RE\n")
+		}
+	}
+	fmt.Fprintf(w, ".SH ENVIRONMENT\n")
+	env := map[string]string{
+		"TELEGRAM_BOT_TOKEN": "Bot used for alerts and commands, also read from .env",
+		"TELEGRAM_CHAT_ID":   "Chat the alerts are sent to",
+		"PINGGO_API_TOKEN":   "API token with the write scope, used by reload",
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, ".TP\n\\fB%s\\fR\n%s\n", roff(name), roff(env[name]))
+	}
+	fmt.Fprintf(w, ".SH FILES\n.TP\n\\fIdevices.yaml\\fR\nDevices and settings\n.TP\n\\fI.env\\fR\nSecrets, loaded into the environment\n")
+	return nil
+}
+
+// runStandaloneCommand runs the commands that need no config; it reports false for the others
+func runStandaloneCommand(name string, args []string) (bool, error) {
+	switch name {
+	case "completion":
+		return true, runCompletionCommand(os.Stdout, args)
+	case "man":
+		return true, runManCommand(os.Stdout)
+	}
+	return false, nil
+}
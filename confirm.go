@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// confirmReachable checks a device that did not answer ICMP with its secondary probe, so devices that
+// rate-limit or drop pings are not reported down. Supported probes are "tcp:<port>" and "arp" (Linux only).
+func confirmReachable(device Device) (bool, error) {
+	method, arg, _ := strings.Cut(device.Confirm, ":")
+	switch method {
+	case "tcp":
+		port, err := strconv.Atoi(arg)
+		if err != nil || port <= 0 || port > 65535 {
+			return false, fmt.Errorf("invalid confirm port %q", arg)
+		}
+		conn, err := dialProbe(device.Group, net.JoinHostPort(device.IP, arg), 3*time.Second)
+		if err != nil {
+			return false, nil
+		}
+		conn.Close()
+		return true, nil
+	case "arp":
+		return arpResolves(device.IP)
+	}
+	return false, fmt.Errorf("unknown confirm probe %q", device.Confirm)
+}
+
+// arpResolves reports whether the kernel has a complete ARP entry for a host on a local subnet.
+// Sending a UDP datagram first makes the kernel resolve the address if it has no fresh entry.
+func arpResolves(ip string) (bool, error) {
+	if conn, err := net.Dial("udp", net.JoinHostPort(ip, "9")); err == nil {
+		conn.Write([]byte{0})
+		conn.Close()
+	}
+	time.Sleep(time.Second)
+
+	file, err := os.Open("/proc/net/arp")
+	if err != nil {
+		return false, fmt.Errorf("could not read ARP table: %w", err)
+	}
+	defer file.Close()
+
+	// IP address, HW type, Flags, HW address, Mask, Device
+	scanner := bufio.NewScanner(file)
+	scanner.Scan()
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 4 && fields[0] == ip {
+			flags, _ := strconv.ParseUint(strings.TrimPrefix(fields[2], "0x"), 16, 32)
+			return flags&0x2 != 0 && fields[3] != "00:00:00:00:00:00", nil
+		}
+	}
+	return false, scanner.Err()
+}
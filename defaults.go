@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// inherit fills the probe settings and thresholds a device leaves empty from a profile or the defaults block
+func inherit(device Device, from Device) Device {
+	if device.Interval == 0 {
+		device.Interval = from.Interval
+	}
+	if device.Timeout == 0 {
+		device.Timeout = from.Timeout
+	}
+	if device.Count == 0 {
+		device.Count = from.Count
+	}
+	if device.Probe == "" {
+		device.Probe = from.Probe
+	}
+	if device.Confirm == "" {
+		device.Confirm = from.Confirm
+	}
+	if device.Severity == "" {
+		device.Severity = from.Severity
+	}
+	if device.DegradedRTT == 0 {
+		device.DegradedRTT = from.DegradedRTT
+	}
+	if device.Ports == nil {
+		device.Ports = from.Ports
+	}
+	if device.ExpectedPorts == nil {
+		device.ExpectedPorts = from.ExpectedPorts
+	}
+	if device.TLSPorts == nil {
+		device.TLSPorts = from.TLSPorts
+	}
+	if device.Site == "" && device.Location == nil {
+		device.Site = from.Site
+		device.Location = from.Location
+	}
+	return device
+}
+
+// resolveDevices applies the profile of every device, then the defaults block
+func (c *Config) resolveDevices(devices []Device) ([]Device, error) {
+	result := make([]Device, len(devices))
+	for i, device := range devices {
+		if device.Profile != "" {
+			profile, ok := c.Profiles[device.Profile]
+			if !ok {
+				return nil, fmt.Errorf("device %s uses unknown profile %q", device.Description, device.Profile)
+			}
+			device = inherit(device, profile)
+		}
+		device = inherit(device, c.Defaults)
+		if !validSeverity(device.Severity) {
+			return nil, fmt.Errorf("device %s has unknown severity %q", device.Description, device.Severity)
+		}
+		if device.Probe == "synthetic" {
+			var err error
+			if device, err = resolveSynthetic(device); err != nil {
+				return nil, err
+			}
+		} else if c.Groups[device.Group].Proxy != nil && !strings.HasPrefix(device.Probe, "tcp:") && device.Probe != "relay" {
+			return nil, fmt.Errorf("device %s is in group %s, which is reached through a proxy that only carries tcp probes", device.Description, device.Group)
+		}
+		if device.Probe == "relay" && c.Groups[device.Group].Relay == nil {
+			return nil, fmt.Errorf("device %s uses the relay probe, but group %q has no relay", device.Description, device.Group)
+		}
+		if _, ok := c.Sites[device.Site]; device.Site != "" && !ok {
+			return nil, fmt.Errorf("device %s uses unknown site %q", device.Description, device.Site)
+		}
+		result[i] = device
+	}
+	return result, nil
+}
+
+// checkDuplicateIPs refuses devices listed twice under the same IP. State, mutes and alerts are kept per IP,
+// so the second entry would silently share them with the first.
+func checkDuplicateIPs(devices []Device) error {
+	seen := make(map[string]string, len(devices))
+	for _, device := range devices {
+		if first, ok := seen[device.IP]; ok {
+			return fmt.Errorf("devices %s and %s have the same IP %s, list each address once", first, device.Description, device.IP)
+		}
+		seen[device.IP] = device.Description
+	}
+	return nil
+}
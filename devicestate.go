@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// DeviceState is the state of a device in the monitoring state machine
+type DeviceState string
+
+const (
+	StateUnknown      DeviceState = "unknown"       // Not checked yet
+	StateUp           DeviceState = "up"            // All probes answered
+	StateDegraded     DeviceState = "degraded"      // Some probes lost or RTT above degraded_rtt
+	StateDown         DeviceState = "down"          // No probe answered
+	StateFlapping     DeviceState = "flapping"      // Changing state too often to alert on each change
+	StateMaintenance  DeviceState = "maintenance"   // Inside a maintenance window
+	StateMuted        DeviceState = "muted"         // Muted by an operator
+	StateExpectedDown DeviceState = "expected-down" // Down, but configured with expected_down
+)
+
+// allStates lists the states in the order they are shown in metrics
+var allStates = []DeviceState{StateUnknown, StateUp, StateDegraded, StateDown, StateFlapping, StateMaintenance, StateMuted, StateExpectedDown}
+
+// defaultNotifyStates are the states that trigger a notification when entered, unless configured otherwise
+var defaultNotifyStates = map[DeviceState]bool{
+	StateUp:       true,
+	StateDegraded: true,
+	StateDown:     true,
+	StateFlapping: true,
+}
+
+// Emoji returns the symbol used for the state in messages and the console table
+func (s DeviceState) Emoji() string {
+	switch s {
+	case StateUp:
+		return "🟢"
+	case StateDegraded:
+		return "🟡"
+	case StateDown:
+		return "🔴"
+	case StateFlapping:
+		return "🔁"
+	case StateMaintenance:
+		return "🔧"
+	case StateMuted:
+		return "🔕"
+	case StateExpectedDown:
+		return "💤"
+	}
+	return "❔"
+}
+
+// Quiet reports whether the state hides the probe result from alerting
+func (s DeviceState) Quiet() bool {
+	return s == StateMaintenance || s == StateMuted || s == StateExpectedDown
+}
+
+// Recovered reports whether the state ends an outage. Flapping, quiet and unknown states do not: the
+// device has not shown that it is healthy again.
+func (s DeviceState) Recovered() bool {
+	return s == StateUp || s == StateDegraded
+}
+
+// MaintenanceWindow is a recurring period in which a device is not alerted on, e.g. Saturdays 22:00-02:00
+type MaintenanceWindow struct {
+	Days []string `yaml:"days,omitempty"` // Weekdays the window starts on ("mon", "saturday", ...); empty means every day
+	From string   `yaml:"from"`           // Local start time, "22:00"
+	To   string   `yaml:"to"`             // Local end time, "02:00"; windows ending before they start run past midnight
+}
+
+// Active reports whether t falls inside the window
+func (w MaintenanceWindow) Active(t time.Time) bool {
+	from, err1 := time.Parse("15:04", w.From)
+	to, err2 := time.Parse("15:04", w.To)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	minute := t.Hour()*60 + t.Minute()
+	start := from.Hour()*60 + from.Minute()
+	end := to.Hour()*60 + to.Minute()
+
+	if start <= end {
+		return minute >= start && minute < end && w.onDay(t.Weekday())
+	}
+	// Overnight window: the part after midnight belongs to the previous day's window
+	if minute >= start {
+		return w.onDay(t.Weekday())
+	}
+	return minute < end && w.onDay((t.Weekday()+6)%7)
+}
+
+func (w MaintenanceWindow) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	name := strings.ToLower(day.String())
+	for _, d := range w.Days {
+		d = strings.ToLower(d)
+		if len(d) >= 3 && strings.HasPrefix(name, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// probeState classifies the result of pinging a device as up, degraded or down
+func probeState(device Device, stats *ping.Statistics, err error) DeviceState {
+	if err != nil || stats == nil || stats.PacketsRecv == 0 {
+		return StateDown
+	}
+	if stats.PacketsRecv < stats.PacketsSent {
+		return StateDegraded
+	}
+	if device.DegradedRTT > 0 && stats.AvgRtt > device.DegradedRTT.Duration() {
+		return StateDegraded
+	}
+	return StateUp
+}
+
+// deviceState applies maintenance windows, blackouts, mutes and expected_down on top of the probe result
+func deviceState(device Device, probe DeviceState, blackouts []Blackout, mutedUntil time.Time, now time.Time) DeviceState {
+	for _, window := range device.Maintenance {
+		if window.Active(now) {
+			return StateMaintenance
+		}
+	}
+	for _, blackout := range blackouts {
+		if blackout.Covers(device, now) {
+			return StateMaintenance
+		}
+	}
+	if now.Before(mutedUntil) {
+		return StateMuted
+	}
+	if probe == StateDown && device.ExpectedDown {
+		return StateExpectedDown
+	}
+	return probe
+}
+
+// shouldNotify decides whether a state change is announced in the chat channels.
+// Coming back up after a quiet state is not news, the device was not reported down.
+func (m *monitor) shouldNotify(change StatusChange) bool {
+	if change.State == StateUp && change.PreviousState.Quiet() {
+		return false
+	}
+	if enabled, ok := m.config.NotifyStates[change.State]; ok {
+		return enabled
+	}
+	return defaultNotifyStates[change.State]
+}
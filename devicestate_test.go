@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+func TestProbeState(t *testing.T) {
+	slow := Device{DegradedRTT: Duration(100 * time.Millisecond)}
+	tests := []struct {
+		name   string
+		device Device
+		stats  *ping.Statistics
+		err    error
+		want   DeviceState
+	}{
+		{"error", Device{}, &ping.Statistics{PacketsSent: 3, PacketsRecv: 3}, errors.New("timeout"), StateDown},
+		{"no statistics", Device{}, nil, nil, StateDown},
+		{"nothing answered", Device{}, &ping.Statistics{PacketsSent: 3}, nil, StateDown},
+		{"some lost", Device{}, &ping.Statistics{PacketsSent: 3, PacketsRecv: 2}, nil, StateDegraded},
+		{"all answered", Device{}, &ping.Statistics{PacketsSent: 3, PacketsRecv: 3}, nil, StateUp},
+		{"above degraded_rtt", slow, &ping.Statistics{PacketsSent: 3, PacketsRecv: 3, AvgRtt: 150 * time.Millisecond}, nil, StateDegraded},
+		{"below degraded_rtt", slow, &ping.Statistics{PacketsSent: 3, PacketsRecv: 3, AvgRtt: 50 * time.Millisecond}, nil, StateUp},
+	}
+	for _, tt := range tests {
+		if got := probeState(tt.device, tt.stats, tt.err); got != tt.want {
+			t.Errorf("%s: probeState = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDeviceState(t *testing.T) {
+	// A Wednesday at 12:00
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.Local)
+	device := Device{Description: "Printer", IP: "10.0.0.5", Group: "office"}
+	inWindow := device
+	inWindow.Maintenance = []MaintenanceWindow{{From: "11:00", To: "13:00"}}
+	outsideWindow := device
+	outsideWindow.Maintenance = []MaintenanceWindow{{Days: []string{"sat"}, From: "11:00", To: "13:00"}}
+	expectedDown := device
+	expectedDown.ExpectedDown = true
+
+	groupBlackout := []Blackout{{Group: "office", From: now.Add(-time.Hour), Until: now.Add(time.Hour)}}
+	deviceBlackout := []Blackout{{Device: "printer", From: now.Add(-time.Hour), Until: now.Add(time.Hour)}}
+	endedBlackout := []Blackout{{Group: "office", From: now.Add(-2 * time.Hour), Until: now.Add(-time.Hour)}}
+	otherBlackout := []Blackout{{Group: "lab", From: now.Add(-time.Hour), Until: now.Add(time.Hour)}}
+
+	tests := []struct {
+		name      string
+		device    Device
+		probe     DeviceState
+		blackouts []Blackout
+		muted     time.Time
+		want      DeviceState
+	}{
+		{"probe result", device, StateDown, nil, time.Time{}, StateDown},
+		{"flapping passes through", device, StateFlapping, nil, time.Time{}, StateFlapping},
+		{"maintenance window", inWindow, StateDown, nil, time.Time{}, StateMaintenance},
+		{"window on another day", outsideWindow, StateDown, nil, time.Time{}, StateDown},
+		{"group blackout", device, StateDown, groupBlackout, time.Time{}, StateMaintenance},
+		{"device blackout by description", device, StateUp, deviceBlackout, time.Time{}, StateMaintenance},
+		{"ended blackout", device, StateDown, endedBlackout, time.Time{}, StateDown},
+		{"blackout of another group", device, StateDown, otherBlackout, time.Time{}, StateDown},
+		{"muted", device, StateDown, nil, now.Add(time.Minute), StateMuted},
+		{"mute expired", device, StateDown, nil, now.Add(-time.Minute), StateDown},
+		{"maintenance before mute", inWindow, StateDown, nil, now.Add(time.Minute), StateMaintenance},
+		{"expected down", expectedDown, StateDown, nil, time.Time{}, StateExpectedDown},
+		{"expected down but up", expectedDown, StateUp, nil, time.Time{}, StateUp},
+		{"mute before expected down", expectedDown, StateDown, nil, now.Add(time.Minute), StateMuted},
+	}
+	for _, tt := range tests {
+		if got := deviceState(tt.device, tt.probe, tt.blackouts, tt.muted, now); got != tt.want {
+			t.Errorf("%s: deviceState = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMaintenanceWindowActive(t *testing.T) {
+	overnight := MaintenanceWindow{Days: []string{"saturday"}, From: "22:00", To: "02:00"}
+	tests := []struct {
+		name   string
+		window MaintenanceWindow
+		at     time.Time
+		want   bool
+	}{
+		{"saturday evening", overnight, time.Date(2026, 10, 17, 23, 0, 0, 0, time.Local), true},
+		{"after midnight belongs to saturday", overnight, time.Date(2026, 10, 18, 1, 0, 0, 0, time.Local), true},
+		{"end is exclusive", overnight, time.Date(2026, 10, 18, 2, 0, 0, 0, time.Local), false},
+		{"sunday evening", overnight, time.Date(2026, 10, 18, 23, 0, 0, 0, time.Local), false},
+		{"friday after midnight", overnight, time.Date(2026, 10, 17, 1, 0, 0, 0, time.Local), false},
+		{"every day", MaintenanceWindow{From: "08:00", To: "09:00"}, time.Date(2026, 10, 14, 8, 30, 0, 0, time.Local), true},
+		{"invalid time", MaintenanceWindow{From: "8", To: "9"}, time.Date(2026, 10, 14, 8, 30, 0, 0, time.Local), false},
+	}
+	for _, tt := range tests {
+		if got := tt.window.Active(tt.at); got != tt.want {
+			t.Errorf("%s: Active = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestStateRecovered(t *testing.T) {
+	for _, state := range allStates {
+		want := state == StateUp || state == StateDegraded
+		if got := state.Recovered(); got != want {
+			t.Errorf("%s.Recovered() = %v, want %v", state, got, want)
+		}
+	}
+}
+
+func TestFlapDetector(t *testing.T) {
+	start := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	minute := func(n int) time.Time { return start.Add(time.Duration(n) * time.Minute) }
+	config := FlappingConfig{Changes: 2, Window: Duration(5 * time.Minute), Stable: Duration(20 * time.Minute)}
+
+	steps := []struct {
+		at    time.Time
+		probe DeviceState
+		want  DeviceState
+	}{
+		{minute(0), StateUp, StateUp},
+		{minute(1), StateDown, StateDown},
+		{minute(2), StateUp, StateUp},
+		{minute(3), StateDown, StateFlapping}, // Third change within the window
+		{minute(10), StateDown, StateFlapping},
+		// The changes fell out of the window, but stable is longer than the window
+		{minute(22), StateDown, StateFlapping},
+		{minute(23), StateDown, StateDown},
+		{minute(24), StateUp, StateUp},
+	}
+	detector := newFlapDetector(config)
+	for i, step := range steps {
+		if got := detector.Update("10.0.0.1", step.probe, step.at); got != step.want {
+			t.Errorf("step %d at %s: Update(%s) = %s, want %s", i, step.at.Format("15:04"), step.probe, got, step.want)
+		}
+	}
+
+	if got := newFlapDetector(FlappingConfig{}).Update("10.0.0.1", StateDown, start); got != StateDown {
+		t.Errorf("disabled detector returned %s, want the probe result", got)
+	}
+}
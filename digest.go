@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DigestConfig sends a consolidated summary of all events at a fixed cadence, next to the immediate alerts.
+// The Telegram chat is read from TELEGRAM_DIGEST_CHAT_ID (and optionally TELEGRAM_DIGEST_BOT_TOKEN).
+type DigestConfig struct {
+	Interval Duration  `yaml:"interval"` // Defaults to 1h
+	Webhooks []Webhook `yaml:"webhooks"` // Also receive the digest as JSON
+
+	MinSeverity string `yaml:"min_severity"` // Only collect changes of devices at least this severe
+}
+
+// Digest is the payload posted to digest webhooks
+type Digest struct {
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	Changes  []StatusChange `json:"changes"`
+	Alerts   []string       `json:"alerts,omitempty"` // Port and TLS alerts
+	Affected []DeviceResult `json:"affected"`         // Devices not up at the end of the period
+}
+
+// digester accumulates events between digests
+type digester struct {
+	interval time.Duration
+	webhooks []Webhook
+	botToken string
+	chatID   string
+
+	mu      sync.Mutex
+	from    time.Time
+	changes []StatusChange
+	alerts  []string
+	results []DeviceResult
+}
+
+func newDigester(config *DigestConfig, botToken, chatID string) *digester {
+	interval := config.Interval.Duration()
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &digester{
+		interval: interval,
+		webhooks: config.Webhooks,
+		botToken: botToken,
+		chatID:   chatID,
+		from:     time.Now(),
+	}
+}
+
+// Add records the events of a completed cycle
+func (d *digester) Add(changes []StatusChange, alerts []string, results []DeviceResult) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, change := range changes {
+		// The first observation of a device is not an event
+		if change.PreviousState != "" {
+			d.changes = append(d.changes, change)
+		}
+	}
+	d.alerts = append(d.alerts, alerts...)
+	d.results = results
+}
+
+// Run sends a digest every interval; periods without events are skipped
+func (d *digester) Run() {
+	for range time.Tick(d.interval) {
+		digest := d.flush(time.Now())
+		if len(digest.Changes) == 0 && len(digest.Alerts) == 0 {
+			continue
+		}
+
+		if d.chatID != "" {
+			if err := recordDelivery("digest", sendTelegramMessage(d.botToken, d.chatID, formatDigest(digest))); err != nil {
+				fmt.Printf("Error sending digest: %v\n", err)
+			}
+		}
+		for _, webhook := range d.webhooks {
+			if err := recordDelivery(webhook.Label(), webhook.post(digest)); err != nil {
+				fmt.Printf("Error sending digest webhook to %s: %v\n", webhook.URL, err)
+			}
+		}
+	}
+}
+
+// Pending returns how many events are waiting for the next digest
+func (d *digester) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.changes) + len(d.alerts)
+}
+
+// flush returns the events accumulated since the previous digest and starts a new period
+func (d *digester) flush(now time.Time) Digest {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	digest := Digest{From: d.from, To: now, Changes: d.changes, Alerts: d.alerts, Affected: []DeviceResult{}}
+	for _, result := range d.results {
+		if result.State != StateUp && !result.State.Quiet() {
+			digest.Affected = append(digest.Affected, result)
+		}
+	}
+	d.from, d.changes, d.alerts = now, nil, nil
+	return digest
+}
+
+// formatDigest renders a digest as a Telegram message
+func formatDigest(digest Digest) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "📋 Digest %s – %s\n", digest.From.Format("Jan 2 15:04"), digest.To.Format("15:04"))
+
+	if len(digest.Changes) > 0 {
+		fmt.Fprintf(&b, "\n%d state changes:\n", len(digest.Changes))
+		for _, change := range digest.Changes {
+			fmt.Fprintf(&b, "%s %s %s (%s): %s → %s\n", change.Time.Format("15:04"), change.State.Emoji(),
+				change.Description, change.IP, change.PreviousState, change.State)
+		}
+	}
+	if len(digest.Alerts) > 0 {
+		b.WriteString("\nAlerts:\n")
+		for _, alert := range digest.Alerts {
+			b.WriteString(alert + "\n")
+		}
+	}
+
+	if len(digest.Affected) == 0 {
+		b.WriteString("\n✅ All devices up now")
+	} else {
+		var affected []string
+		for _, result := range digest.Affected {
+			affected = append(affected, fmt.Sprintf("%s (%s)", result.Description, result.State))
+		}
+		b.WriteString("\nNot up now: " + strings.Join(affected, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"gopkg.in/yaml.v2"
+)
+
+// discoveryCandidate is a device found on the LAN that could be enrolled into monitoring
+type discoveryCandidate struct {
+	IP      string
+	Name    string
+	Source  string // "mDNS" or "SSDP"
+	Details string
+}
+
+var (
+	mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+	ssdpGroup = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+	// Service types queried over mDNS, covering the usual printers, cameras and IoT gadgets
+	mdnsServices = []string{
+		"_services._dns-sd._udp.local.",
+		"_http._tcp.local.",
+		"_ipp._tcp.local.",
+		"_printer._tcp.local.",
+		"_pdl-datastream._tcp.local.",
+		"_rtsp._tcp.local.",
+		"_onvif._tcp.local.",
+		"_googlecast._tcp.local.",
+		"_airplay._tcp.local.",
+		"_hap._tcp.local.",
+		"_workstation._tcp.local.",
+		"_ssh._tcp.local.",
+	}
+
+	friendlyNamePattern = regexp.MustCompile(`<friendlyName>([^<]+)</friendlyName>`)
+)
+
+// discoveryResults collects candidates from several listeners, keeping the best name per IP
+type discoveryResults struct {
+	mu         sync.Mutex
+	candidates map[string]*discoveryCandidate
+}
+
+func (r *discoveryResults) add(c discoveryCandidate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	existing, ok := r.candidates[c.IP]
+	if !ok {
+		r.candidates[c.IP] = &c
+		return
+	}
+	if existing.Name == "" {
+		existing.Name = c.Name
+	}
+	if !strings.Contains(existing.Source, c.Source) {
+		existing.Source += "+" + c.Source
+	}
+	if existing.Details == "" {
+		existing.Details = c.Details
+	}
+}
+
+// discoverDevices queries and listens for mDNS and SSDP announcements for the given duration
+func discoverDevices(duration time.Duration) []discoveryCandidate {
+	results := &discoveryResults{candidates: make(map[string]*discoveryCandidate)}
+	deadline := time.Now().Add(duration)
+
+	var wg sync.WaitGroup
+	for _, discover := range []func(*discoveryResults, time.Time) error{queryMDNS, listenMDNS, querySSDP, listenSSDP} {
+		wg.Add(1)
+		go func(discover func(*discoveryResults, time.Time) error) {
+			defer wg.Done()
+			if err := discover(results, deadline); err != nil {
+				fmt.Printf("Discovery: %v\n", err)
+			}
+		}(discover)
+	}
+	wg.Wait()
+
+	candidates := make([]discoveryCandidate, 0, len(results.candidates))
+	for _, c := range results.candidates {
+		candidates = append(candidates, *c)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := net.ParseIP(candidates[i].IP).To4(), net.ParseIP(candidates[j].IP).To4()
+		if a == nil || b == nil {
+			return candidates[i].IP < candidates[j].IP
+		}
+		return string(a) < string(b)
+	})
+	return candidates
+}
+
+// queryMDNS asks for the known service types and asks responders to answer by unicast
+func queryMDNS(results *discoveryResults, deadline time.Time) error {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return fmt.Errorf("could not open mDNS socket: %w", err)
+	}
+	defer conn.Close()
+
+	msg := dnsmessage.Message{}
+	for _, service := range mdnsServices {
+		msg.Questions = append(msg.Questions, dnsmessage.Question{
+			Name:  dnsmessage.MustNewName(service),
+			Type:  dnsmessage.TypePTR,
+			Class: dnsmessage.ClassINET | 0x8000, // Unicast response requested
+		})
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return fmt.Errorf("could not build mDNS query: %w", err)
+	}
+	if _, err := conn.WriteToUDP(packed, mdnsGroup); err != nil {
+		return fmt.Errorf("could not send mDNS query: %w", err)
+	}
+
+	readMDNS(conn, results, deadline)
+	return nil
+}
+
+// listenMDNS passively collects multicast mDNS announcements
+func listenMDNS(results *discoveryResults, deadline time.Time) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return fmt.Errorf("could not listen for mDNS announcements: %w", err)
+	}
+	defer conn.Close()
+	readMDNS(conn, results, deadline)
+	return nil
+}
+
+func readMDNS(conn *net.UDPConn, results *discoveryResults, deadline time.Time) {
+	conn.SetReadDeadline(deadline)
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if name, details, ok := parseMDNSResponse(buf[:n]); ok {
+			results.add(discoveryCandidate{IP: from.IP.String(), Name: name, Source: "mDNS", Details: details})
+		}
+	}
+}
+
+// parseMDNSResponse extracts a human readable name and the advertised services from an mDNS response
+func parseMDNSResponse(packet []byte) (name, details string, ok bool) {
+	var p dnsmessage.Parser
+	header, err := p.Start(packet)
+	if err != nil || !header.Response {
+		return "", "", false
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return "", "", false
+	}
+
+	var host string
+	services := make(map[string]bool)
+	// Responders put the useful records in either the answer or the additional section
+	for section := 0; section < 3; section++ {
+		for {
+			var rh dnsmessage.ResourceHeader
+			switch section {
+			case 0:
+				rh, err = p.AnswerHeader()
+			case 1:
+				rh, err = p.AuthorityHeader()
+			case 2:
+				rh, err = p.AdditionalHeader()
+			}
+			if err != nil {
+				break
+			}
+
+			switch rh.Type {
+			case dnsmessage.TypePTR:
+				ptr, err := p.PTRResource()
+				if err != nil {
+					return "", "", false
+				}
+				instance := ptr.PTR.String()
+				if service := strings.TrimSuffix(rh.Name.String(), ".local."); !strings.HasPrefix(service, "_services.") {
+					services[service] = true
+					if name == "" {
+						name = strings.TrimSuffix(strings.TrimSuffix(instance, rh.Name.String()), ".")
+					}
+				}
+			case dnsmessage.TypeA:
+				if _, err := p.AResource(); err != nil {
+					return "", "", false
+				}
+				host = strings.TrimSuffix(strings.TrimSuffix(rh.Name.String(), "."), ".local")
+			default:
+				err = skipResource(&p, section)
+				if err != nil {
+					return "", "", false
+				}
+			}
+		}
+	}
+
+	if name == "" {
+		name = host
+	}
+	if name == "" && len(services) == 0 {
+		return "", "", false
+	}
+	list := make([]string, 0, len(services))
+	for service := range services {
+		list = append(list, service)
+	}
+	sort.Strings(list)
+	return unescapeDNS(name), strings.Join(list, " "), true
+}
+
+func skipResource(p *dnsmessage.Parser, section int) error {
+	switch section {
+	case 0:
+		return p.SkipAnswer()
+	case 1:
+		return p.SkipAuthority()
+	default:
+		return p.SkipAdditional()
+	}
+}
+
+// unescapeDNS turns "\032" style escapes in DNS-SD instance names back into characters
+func unescapeDNS(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if code, err := strconv.Atoi(s[i+1 : i+4]); err == nil {
+				b.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+		}
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// querySSDP sends an M-SEARCH for all devices and collects the unicast replies
+func querySSDP(results *discoveryResults, deadline time.Time) error {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return fmt.Errorf("could not open SSDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	search := "M-SEARCH * HTTP/1.1\r\n" +
+		"HOST: 239.255.255.250:1900\r\n" +
+		"MAN: \"ssdp:discover\"\r\n" +
+		"MX: 2\r\n" +
+		"ST: ssdp:all\r\n\r\n"
+	if _, err := conn.WriteToUDP([]byte(search), ssdpGroup); err != nil {
+		return fmt.Errorf("could not send SSDP search: %w", err)
+	}
+
+	readSSDP(conn, results, deadline)
+	return nil
+}
+
+// listenSSDP passively collects NOTIFY announcements
+func listenSSDP(results *discoveryResults, deadline time.Time) error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, ssdpGroup)
+	if err != nil {
+		return fmt.Errorf("could not listen for SSDP announcements: %w", err)
+	}
+	defer conn.Close()
+	readSSDP(conn, results, deadline)
+	return nil
+}
+
+func readSSDP(conn *net.UDPConn, results *discoveryResults, deadline time.Time) {
+	conn.SetReadDeadline(deadline)
+	buf := make([]byte, 4096)
+	seenLocations := make(map[string]bool)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		headers := parseSSDPHeaders(string(buf[:n]))
+		if headers == nil {
+			continue
+		}
+
+		candidate := discoveryCandidate{IP: from.IP.String(), Source: "SSDP", Details: headers["server"]}
+		// The description document usually carries a proper device name
+		if location := headers["location"]; location != "" && !seenLocations[location] {
+			seenLocations[location] = true
+			candidate.Name = fetchSSDPFriendlyName(location)
+		}
+		results.add(candidate)
+	}
+}
+
+// parseSSDPHeaders parses the HTTP-like headers of an SSDP response or NOTIFY message
+func parseSSDPHeaders(msg string) map[string]string {
+	lines := strings.Split(msg, "\r\n")
+	if len(lines) == 0 || !(strings.HasPrefix(lines[0], "HTTP/1.1 200") || strings.HasPrefix(lines[0], "NOTIFY")) {
+		return nil
+	}
+	headers := make(map[string]string)
+	for _, line := range lines[1:] {
+		if key, value, ok := strings.Cut(line, ":"); ok {
+			headers[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+		}
+	}
+	return headers
+}
+
+func fetchSSDPFriendlyName(location string) string {
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(location)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return ""
+	}
+	if match := friendlyNamePattern.FindSubmatch(body); match != nil {
+		return strings.TrimSpace(string(match[1]))
+	}
+	return ""
+}
+
+type discoverOptions struct {
+	duration time.Duration
+	group    string
+}
+
+func (o *discoverOptions) flags(fs *flag.FlagSet) {
+	fs.DurationVar(&o.duration, "duration", 10*time.Second, "how long to listen for announcements")
+	fs.StringVar(&o.group, "group", "", "`group` assigned to enrolled devices")
+}
+
+// runDiscoverCommand implements "ping_monitor discover": it lists candidates that are not monitored yet
+// and, after confirmation, adds the chosen ones to the config file
+func runDiscoverCommand(config *Config, configFile string, args []string) error {
+	var options discoverOptions
+	fs := flag.NewFlagSet("discover", flag.ExitOnError)
+	options.flags(fs)
+	fs.Parse(args)
+
+	fmt.Printf("Listening for mDNS and SSDP announcements for %s...\n", options.duration)
+	monitored := make(map[string]bool)
+	for _, device := range config.Devices {
+		monitored[device.IP] = true
+	}
+
+	var candidates []discoveryCandidate
+	for _, c := range discoverDevices(options.duration) {
+		if !monitored[c.IP] {
+			candidates = append(candidates, c)
+		}
+	}
+	if len(candidates) == 0 {
+		fmt.Println("No new devices found.")
+		return nil
+	}
+
+	fmt.Printf("\n| %-3s | %-15s | %-30s | %-9s | %s\n", "#", "IP", "Name", "Source", "Details")
+	fmt.Println("|-----|-----------------|--------------------------------|-----------|---------")
+	for i, c := range candidates {
+		fmt.Printf("| %-3d | %-15s | %-30s | %-9s | %s\n", i+1, c.IP, c.Name, c.Source, c.Details)
+	}
+
+	fmt.Print("\nEnroll which devices? (e.g. 1,3 or all, empty to skip): ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if answer == "" {
+		return nil
+	}
+
+	var selected []Device
+	for i, c := range candidates {
+		if answer != "all" && !containsIndex(answer, i+1) {
+			continue
+		}
+		name := c.Name
+		if name == "" {
+			name = c.IP
+		}
+		selected = append(selected, Device{Description: name, IP: c.IP, Group: options.group})
+	}
+	if err := appendDevices(configFile, selected); err != nil {
+		return err
+	}
+	fmt.Printf("Added %d devices to %s\n", len(selected), configFile)
+	return nil
+}
+
+func containsIndex(list string, index int) bool {
+	for _, field := range strings.Split(list, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(field)); err == nil && n == index {
+			return true
+		}
+	}
+	return false
+}
+
+// appendDevices inserts devices at the end of the devices: list of the config file.
+// The file is edited as text so comments and formatting are preserved.
+func appendDevices(filename string, devices []Device) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("could not read config file: %w", err)
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "devices:") {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		lines = append(lines, "", "devices:")
+		start = len(lines) - 1
+	}
+
+	// The list ends at the next top-level key; items keep the indentation of the existing ones
+	end := len(lines)
+	indent := "  "
+	for i := start + 1; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimLeft(line, " ")
+		if strings.HasPrefix(trimmed, "- ") && indent == "  " {
+			indent = line[:len(line)-len(trimmed)]
+		}
+		if line != "" && trimmed == line && !strings.HasPrefix(line, "#") && !strings.HasPrefix(line, "- ") {
+			end = i
+			break
+		}
+	}
+	// Keep blank lines and comments that precede the next key with that key
+	for end > start+1 && (strings.TrimSpace(lines[end-1]) == "" || strings.HasPrefix(lines[end-1], "#")) {
+		end--
+	}
+
+	var added []string
+	for _, device := range devices {
+		data, err := yaml.Marshal(device)
+		if err != nil {
+			return fmt.Errorf("could not encode device %s: %w", device.Description, err)
+		}
+		for i, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+			prefix := "  "
+			if i == 0 {
+				prefix = "- "
+			}
+			added = append(added, indent+prefix+line)
+		}
+	}
+
+	result := append(append(append([]string{}, lines[:end]...), added...), lines[end:]...)
+	return os.WriteFile(filename, []byte(strings.Join(result, "\n")+"\n"), 0o644)
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSSync describes a DNS zone whose A records are monitored as devices
+type DNSSync struct {
+	Server   string   `yaml:"server"`   // Authoritative server allowing AXFR, e.g. "ns1.example.com:53"
+	Zone     string   `yaml:"zone"`     // Zone to transfer, e.g. "monitor.example.com"
+	Interval Duration `yaml:"interval"` // How often to re-transfer the zone (default 5m)
+}
+
+// dnsSyncer keeps the list of devices discovered in a DNS zone up to date. The zone is transferred by Run
+// on its own ticker, so a slow name server never holds up the check cycle.
+type dnsSyncer struct {
+	config *DNSSync
+
+	mu      sync.Mutex
+	devices []Device
+}
+
+func newDNSSyncer(config *DNSSync) *dnsSyncer {
+	return &dnsSyncer{config: config}
+}
+
+// Run transfers the zone again every sync interval
+func (s *dnsSyncer) Run() {
+	interval := s.config.Interval.Duration()
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	for range time.Tick(interval) {
+		s.Sync()
+	}
+}
+
+// Sync transfers the zone once. On failure the previously synced list is kept so a flaky name server
+// does not drop monitored hosts.
+func (s *dnsSyncer) Sync() {
+	devices, err := transferZone(s.config.Server, s.config.Zone)
+	if err != nil {
+		fmt.Printf("DNS sync of %s failed: %v\n", s.config.Zone, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(devices) != len(s.devices) {
+		fmt.Printf("DNS sync of %s: %d devices (was %d)\n", s.config.Zone, len(devices), len(s.devices))
+	}
+	s.devices = devices
+}
+
+// Devices returns the devices found by the last successful transfer
+func (s *dnsSyncer) Devices() []Device {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.devices
+}
+
+// transferZone performs an AXFR of the zone and returns a device for every A record in it
+func transferZone(server, zone string) ([]Device, error) {
+	if !strings.HasSuffix(zone, ".") {
+		zone += "."
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	name, err := dnsmessage.NewName(zone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zone name: %w", err)
+	}
+
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: uint16(rand.Intn(1 << 16))},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: dnsmessage.TypeAXFR, Class: dnsmessage.ClassINET},
+		},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("could not build AXFR query: %w", err)
+	}
+
+	conn, err := net.DialTimeout("tcp", server, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to %s: %w", server, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(60 * time.Second))
+
+	// DNS over TCP prefixes every message with its length
+	frame := make([]byte, 2+len(packed))
+	binary.BigEndian.PutUint16(frame, uint16(len(packed)))
+	copy(frame[2:], packed)
+	if _, err := conn.Write(frame); err != nil {
+		return nil, fmt.Errorf("could not send AXFR query: %w", err)
+	}
+
+	var devices []Device
+	soaCount := 0
+	// The transfer is complete once the closing SOA record has been seen
+	for soaCount < 2 {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, fmt.Errorf("could not read AXFR response: %w", err)
+		}
+		buf := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, fmt.Errorf("could not read AXFR response: %w", err)
+		}
+
+		var p dnsmessage.Parser
+		header, err := p.Start(buf)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse AXFR response: %w", err)
+		}
+		if header.RCode != dnsmessage.RCodeSuccess {
+			return nil, fmt.Errorf("zone transfer refused: %v", header.RCode)
+		}
+		if err := p.SkipAllQuestions(); err != nil {
+			return nil, fmt.Errorf("could not parse AXFR response: %w", err)
+		}
+
+		for {
+			rh, err := p.AnswerHeader()
+			if err == dnsmessage.ErrSectionDone {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("could not parse AXFR response: %w", err)
+			}
+
+			switch rh.Type {
+			case dnsmessage.TypeSOA:
+				soaCount++
+				err = p.SkipAnswer()
+			case dnsmessage.TypeA:
+				var a dnsmessage.AResource
+				a, err = p.AResource()
+				if err == nil {
+					devices = append(devices, Device{
+						Description: strings.TrimSuffix(rh.Name.String(), "."),
+						IP:          net.IP(a.A[:]).String(),
+					})
+				}
+			default:
+				err = p.SkipAnswer()
+			}
+			if err != nil {
+				return nil, fmt.Errorf("could not parse AXFR response: %w", err)
+			}
+		}
+	}
+
+	return devices, nil
+}
+
+// mergeDevices appends the synced devices to the configured ones, skipping IPs that are already monitored
+func mergeDevices(configured, synced []Device) []Device {
+	seen := make(map[string]bool, len(configured))
+	merged := make([]Device, 0, len(configured)+len(synced))
+	for _, device := range configured {
+		seen[device.IP] = true
+		merged = append(merged, device)
+	}
+	for _, device := range synced {
+		if seen[device.IP] {
+			continue
+		}
+		seen[device.IP] = true
+		merged = append(merged, device)
+	}
+	return merged
+}
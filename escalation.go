@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GroupConfig holds settings shared by all devices of a group
+type GroupConfig struct {
+	Escalation string          `yaml:"escalation"` // Name of the escalation policy, unless the device sets its own
+	OnCall     *OnCallSchedule `yaml:"on_call"`
+	Proxy      *ProbeProxy     `yaml:"proxy"`     // Reach the devices of the group through a SOCKS5 proxy or SSH jump host
+	Relay      *RelayConfig    `yaml:"relay"`     // Host that runs the "relay" probes of the group
+	Namespace  string          `yaml:"namespace"` // Linux network namespace the probes of the group are sent from
+	VRF        string          `yaml:"vrf"`       // Linux VRF device the probes of the group are bound to
+}
+
+// EscalationStep notifies a channel once the previous step has fired and delay has passed,
+// then repeats every delay as many times as repeat says before moving to the next step
+type EscalationStep struct {
+	Channel string   `yaml:"channel"` // "telegram", "oncall" or the name of a webhook or chat
+	Delay   Duration `yaml:"delay"`
+	Repeat  int      `yaml:"repeat"`
+}
+
+// Escalation is posted to webhook channels when an escalation step fires
+type Escalation struct {
+	Description string        `json:"description"`
+	IP          string        `json:"ip"`
+	Policy      string        `json:"policy"`
+	Step        int           `json:"step"` // Starting at 1
+	DownSince   time.Time     `json:"down_since"`
+	Time        time.Time     `json:"time"`
+	OnCall      *OnCallPerson `json:"on_call,omitempty"` // Who is on call for the group of the device
+}
+
+// escalator walks devices that are down through the steps of their escalation policy
+type escalator struct {
+	policies map[string][]EscalationStep
+	groups   map[string]GroupConfig
+	fallback string                      // Policy of the defaults block
+	active   map[string]*escalationState // By IP
+}
+
+type escalationState struct {
+	policy string
+	since  time.Time
+	step   int       // Index of the next step to fire
+	sent   int       // How often the current step has fired
+	next   time.Time // When the current step fires next
+}
+
+func newEscalator(config *Config) (*escalator, error) {
+	e := &escalator{
+		policies: config.EscalationPolicies,
+		groups:   config.Groups,
+		fallback: config.Defaults.Escalation,
+		active:   make(map[string]*escalationState),
+	}
+	for name, steps := range e.policies {
+		if len(steps) == 0 {
+			return nil, fmt.Errorf("escalation policy %q has no steps", name)
+		}
+		for _, step := range steps {
+			if !config.hasChannel(step.Channel) {
+				return nil, fmt.Errorf("escalation policy %q uses unknown channel %q", name, step.Channel)
+			}
+		}
+	}
+	for _, device := range config.Devices {
+		if policy := e.policyFor(device); policy != "" && e.policies[policy] == nil {
+			return nil, fmt.Errorf("device %s uses unknown escalation policy %q", device.Description, policy)
+		}
+	}
+	return e, nil
+}
+
+// policyFor returns the escalation policy of a device, falling back to the one of its group and then the defaults block
+func (e *escalator) policyFor(device Device) string {
+	if device.Escalation != "" {
+		return device.Escalation
+	}
+	if policy := e.groups[device.Group].Escalation; policy != "" {
+		return policy
+	}
+	return e.fallback
+}
+
+// Update fires the escalation steps that are due and stops escalating devices that are no longer down.
+// It is only called from the check loop.
+func (e *escalator) Update(m *monitor, devices []Device, results []DeviceResult, now time.Time) {
+	acks, err := m.state.Acks()
+	if err != nil {
+		fmt.Printf("Error loading acks: %v\n", err)
+	}
+	for _, result := range results {
+		// An ack lasts until the device recovers
+		if _, acked := acks[result.IP]; acked && result.State != StateDown {
+			if err := m.state.Ack(result.IP, ""); err != nil {
+				fmt.Printf("Error clearing ack of %s: %v\n", result.IP, err)
+			}
+			delete(acks, result.IP)
+		}
+
+		device, ok := findDevice(devices, result.IP)
+		if !ok {
+			continue
+		}
+		policy := e.policyFor(device)
+		if result.State != StateDown || e.policies[policy] == nil {
+			delete(e.active, result.IP)
+			continue
+		}
+
+		// Acknowledged incidents are being handled, nobody else needs to be paged
+		if _, acked := acks[result.IP]; acked {
+			continue
+		}
+
+		state, ok := e.active[result.IP]
+		if !ok {
+			state = &escalationState{policy: policy, since: now, next: now.Add(e.policies[policy][0].Delay.Duration())}
+			e.active[result.IP] = state
+		}
+
+		steps := e.policies[state.policy]
+		for state.step < len(steps) && !now.Before(state.next) {
+			step := steps[state.step]
+			e.fire(m, device, state, step, now)
+
+			state.sent++
+			if state.sent > step.Repeat {
+				state.step, state.sent = state.step+1, 0
+				if state.step == len(steps) {
+					break
+				}
+				step = steps[state.step]
+			}
+			state.next = now.Add(step.Delay.Duration())
+			// A zero delay fires the next step right away, anything else waits for a later cycle
+			if step.Delay > 0 {
+				break
+			}
+		}
+	}
+}
+
+// fire notifies the channel of an escalation step
+func (e *escalator) fire(m *monitor, device Device, state *escalationState, step EscalationStep, now time.Time) {
+	if !m.config.channelAccepts(step.Channel, device) {
+		return
+	}
+	message := fmt.Sprintf("🚨 Escalation %s, step %d: %s (%s) has been down for %s",
+		state.policy, state.step+1, device.Description, device.IP, now.Sub(state.since).Round(time.Second))
+	payload := Escalation{
+		Description: device.Description,
+		IP:          device.IP,
+		Policy:      state.policy,
+		Step:        state.step + 1,
+		DownSince:   state.since,
+		Time:        now,
+	}
+	if person, ok := m.config.onCallFor(device, now); ok {
+		payload.OnCall = &person
+	}
+
+	var err error
+	if step.Channel == "oncall" {
+		err = m.notifyOnCall(device, message, now)
+	} else {
+		err = m.notifyChannel(step.Channel, message, payload)
+	}
+	if err != nil {
+		fmt.Printf("Error escalating %s to %s: %v\n", device.Description, step.Channel, err)
+		return
+	}
+	m.incidents.Notified(device.IP, fmt.Sprintf("%s (escalation %s, step %d)", step.Channel, state.policy, state.step+1), now)
+}
+
+// hasChannel reports whether name refers to a notification channel
+func (c *Config) hasChannel(name string) bool {
+	if name == "telegram" || name == "oncall" {
+		return c.UseTelegram
+	}
+	for _, webhook := range c.Webhooks {
+		if webhook.Name != "" && webhook.Name == name {
+			return true
+		}
+	}
+	for _, chat := range c.Chats {
+		if chat.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyOnCall sends a direct Telegram message to whoever is on call for the group of the device
+func (m *monitor) notifyOnCall(device Device, message string, now time.Time) error {
+	person, ok := m.config.onCallFor(device, now)
+	if !ok {
+		return fmt.Errorf("group %q has no on-call schedule", device.Group)
+	}
+	// Bots can only start private chats by user ID, and only with users who have talked to the bot before
+	if person.Telegram == "" || strings.HasPrefix(person.Telegram, "@") {
+		return fmt.Errorf("%s has no Telegram user ID", person.Name)
+	}
+	return recordDelivery("oncall", sendTelegramMessage(m.botToken, person.Telegram, message))
+}
+
+// notifyChannel sends a message to a named channel; webhooks receive payload as JSON instead
+func (m *monitor) notifyChannel(name, message string, payload interface{}) error {
+	if name == "telegram" {
+		return recordDelivery("telegram", sendTelegramMessage(m.botToken, m.chatID, message))
+	}
+	for _, webhook := range m.config.Webhooks {
+		if webhook.Name == name {
+			return recordDelivery(webhook.Label(), webhook.post(payload))
+		}
+	}
+	for _, chat := range m.config.Chats {
+		if chat.Name == name {
+			return recordDelivery(chat.Name, chat.post(message))
+		}
+	}
+	return fmt.Errorf("unknown channel %q", name)
+}
@@ -0,0 +1,19 @@
+package main
+
+// EventLogConfig writes status changes to the Windows Application Event Log
+type EventLogConfig struct {
+	Source string `yaml:"source"` // Event source name, defaults to "PingMonitor"
+}
+
+// eventIDs gives every state a distinct event ID, so Windows tooling can react to specific transitions.
+// Sources registered as EventCreate sources only support IDs 1 to 1000.
+var eventIDs = map[DeviceState]uint32{
+	StateUnknown:      100,
+	StateUp:           101,
+	StateDegraded:     102,
+	StateDown:         103,
+	StateFlapping:     104,
+	StateMaintenance:  105,
+	StateMuted:        106,
+	StateExpectedDown: 107,
+}
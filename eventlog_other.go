@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import "fmt"
+
+// newEventLog is only available on Windows
+func newEventLog(config *EventLogConfig) (historyStore, error) {
+	return nil, fmt.Errorf("the event log is only available on Windows")
+}
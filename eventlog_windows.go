@@ -0,0 +1,59 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+// windowsEventLog records status changes as Application Event Log entries
+type windowsEventLog struct {
+	log *eventlog.Log
+}
+
+// newEventLog opens the event source, registering it first if it does not exist yet.
+// Registering needs administrator rights once; afterwards the monitor can run unprivileged.
+func newEventLog(config *EventLogConfig) (historyStore, error) {
+	source := config.Source
+	if source == "" {
+		source = "PingMonitor"
+	}
+	err := eventlog.InstallAsEventCreate(source, eventlog.Error|eventlog.Warning|eventlog.Info)
+	if err != nil && !strings.Contains(err.Error(), "registry key already exists") {
+		fmt.Printf("Warning: could not register event source %s: %v\n", source, err)
+	}
+
+	log, err := eventlog.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("could not open event log: %w", err)
+	}
+	return &windowsEventLog{log: log}, nil
+}
+
+// Record writes one event per status change: errors for down, warnings for degraded and flapping
+func (l *windowsEventLog) Record(snapshot CycleSnapshot, changes []StatusChange) error {
+	for _, change := range changes {
+		message := fmt.Sprintf("%s (%s) is %s", change.Description, change.IP, change.State)
+		if change.PreviousState != "" {
+			message += fmt.Sprintf(", was %s", change.PreviousState)
+		}
+
+		var err error
+		id := eventIDs[change.State]
+		switch change.State {
+		case StateDown:
+			err = l.log.Error(id, message)
+		case StateDegraded, StateFlapping:
+			err = l.log.Warning(id, message)
+		default:
+			err = l.log.Info(id, message)
+		}
+		if err != nil {
+			return fmt.Errorf("could not write event: %w", err)
+		}
+	}
+	return nil
+}
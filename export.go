@@ -0,0 +1,285 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// DeviceExport is the effective device configuration of a monitor with its runtime state, used to back up
+// a monitor or move its devices to another one
+type DeviceExport struct {
+	Exported  time.Time            `yaml:"exported"`
+	Instance  string               `yaml:"instance"`
+	Sites     map[string]Location  `yaml:"sites,omitempty"`
+	Devices   []Device             `yaml:"devices"`             // With profiles and defaults applied
+	Mutes     map[string]time.Time `yaml:"mutes,omitempty"`     // By IP, muted until
+	Blackouts []Blackout           `yaml:"blackouts,omitempty"` // Current and upcoming
+}
+
+// ImportResult summarizes what an import changed
+type ImportResult struct {
+	Added     []string `json:"added"`   // Descriptions of the new devices
+	Skipped   []string `json:"skipped"` // Devices whose IP is already monitored
+	Mutes     int      `json:"mutes"`
+	Blackouts int      `json:"blackouts"`
+}
+
+// exportDevices collects the devices with the mutes and blackouts that have not ended yet
+func exportDevices(config *Config, state stateStore, devices []Device, now time.Time) (DeviceExport, error) {
+	export := DeviceExport{Exported: now, Instance: config.Instance, Sites: config.Sites, Mutes: make(map[string]time.Time)}
+	for _, device := range devices {
+		// The profile is already applied and may not exist where the export is imported
+		device.Profile = ""
+		export.Devices = append(export.Devices, device)
+	}
+
+	mutes, err := state.Mutes()
+	if err != nil {
+		return export, fmt.Errorf("could not read mutes: %w", err)
+	}
+	for ip, until := range mutes {
+		if until.After(now) {
+			export.Mutes[ip] = until
+		}
+	}
+	blackouts, err := state.Blackouts()
+	if err != nil {
+		return export, fmt.Errorf("could not read blackouts: %w", err)
+	}
+	export.Blackouts = pruneBlackouts(blackouts, now)
+	return export, nil
+}
+
+// prepareImport selects the exported devices that are not monitored yet and makes them valid in this config.
+// It returns the devices as they are written to the config file, the same devices resolved, and the skipped ones.
+func prepareImport(config *Config, export DeviceExport, monitored []Device) ([]Device, []Device, []string, error) {
+	known := make(map[string]bool, len(monitored))
+	for _, device := range monitored {
+		known[device.IP] = true
+	}
+
+	var added []Device
+	var skipped []string
+	for _, device := range export.Devices {
+		if device.IP == "" || known[device.IP] {
+			skipped = append(skipped, device.Description)
+			continue
+		}
+		known[device.IP] = true
+		device.Profile = ""
+		// A site unknown here keeps its place on the map through the coordinates of the export
+		if _, ok := config.Sites[device.Site]; device.Site != "" && !ok {
+			if location, ok := export.Sites[device.Site]; ok && device.Location == nil {
+				device.Location = &location
+			}
+			device.Site = ""
+		}
+		added = append(added, device)
+	}
+
+	resolved, err := config.resolveDevices(added)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return added, resolved, skipped, nil
+}
+
+// importState restores the mutes and blackouts of an export that have not ended yet
+func importState(state stateStore, export DeviceExport, now time.Time) (mutes, blackouts int, err error) {
+	for ip, until := range export.Mutes {
+		if !until.After(now) {
+			continue
+		}
+		if err := state.Mute(ip, until); err != nil {
+			return mutes, blackouts, fmt.Errorf("could not restore mute of %s: %w", ip, err)
+		}
+		mutes++
+	}
+
+	existing, err := state.Blackouts()
+	if err != nil {
+		return mutes, blackouts, fmt.Errorf("could not read blackouts: %w", err)
+	}
+	seen := make(map[string]bool, len(existing))
+	for _, blackout := range existing {
+		seen[blackout.ID] = true
+	}
+	for _, blackout := range pruneBlackouts(export.Blackouts, now) {
+		if seen[blackout.ID] {
+			continue
+		}
+		if err := state.AddBlackout(blackout); err != nil {
+			return mutes, blackouts, fmt.Errorf("could not restore blackout %s: %w", blackout.ID, err)
+		}
+		blackouts++
+	}
+	return mutes, blackouts, nil
+}
+
+// applyImport adds the devices selected by prepareImport to the config file and restores the runtime state of the export
+func applyImport(configFile string, state stateStore, export DeviceExport, added []Device, skipped []string) (ImportResult, error) {
+	result := ImportResult{Added: []string{}, Skipped: skipped}
+	if len(added) > 0 {
+		if err := appendDevices(configFile, added); err != nil {
+			return result, err
+		}
+		for _, device := range added {
+			result.Added = append(result.Added, device.Description)
+		}
+	}
+	var err error
+	result.Mutes, result.Blackouts, err = importState(state, export, time.Now())
+	return result, err
+}
+
+// readExport parses an export written by "ping_monitor export" or GET /api/export
+func readExport(r io.Reader) (DeviceExport, error) {
+	var export DeviceExport
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return export, fmt.Errorf("could not read export: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &export); err != nil {
+		return export, fmt.Errorf("could not parse export: %w", err)
+	}
+	return export, nil
+}
+
+// configuredDevices returns the devices of the config file and, if configured, the DNS zone
+func configuredDevices(config *Config) []Device {
+	devices := config.Devices
+	if config.DNSSync != nil {
+		syncer := newDNSSyncer(config.DNSSync)
+		syncer.Sync()
+		synced, _ := config.resolveDevices(syncer.Devices())
+		devices = mergeDevices(devices, synced)
+	}
+	return devices
+}
+
+type exportOptions struct {
+	output string
+}
+
+func (o *exportOptions) flags(fs *flag.FlagSet) {
+	fs.StringVar(&o.output, "o", "", "`file` to write the export to instead of stdout")
+}
+
+// runExportCommand implements "ping_monitor export [-o file]"
+func runExportCommand(config *Config, state stateStore, args []string) error {
+	var options exportOptions
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	options.flags(fs)
+	fs.Parse(args)
+
+	export, err := exportDevices(config, state, configuredDevices(config), time.Now())
+	if err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(export)
+	if err != nil {
+		return fmt.Errorf("could not encode export: %w", err)
+	}
+	if options.output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(options.output, data, 0o600); err != nil {
+		return fmt.Errorf("could not write export: %w", err)
+	}
+	fmt.Printf("Exported %d devices, %d mutes and %d blackouts to %s\n", len(export.Devices), len(export.Mutes), len(export.Blackouts), options.output)
+	return nil
+}
+
+// runImportCommand implements "ping_monitor import <file>"; a running monitor picks the devices up when restarted
+func runImportCommand(config *Config, configFile string, state stateStore, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: import <file>")
+	}
+
+	file, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("could not open export: %w", err)
+	}
+	defer file.Close()
+	export, err := readExport(file)
+	if err != nil {
+		return err
+	}
+
+	added, _, skipped, err := prepareImport(config, export, configuredDevices(config))
+	if err != nil {
+		return err
+	}
+	result, err := applyImport(configFile, state, export, added, skipped)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Added %d devices to %s, skipped %d already monitored, restored %d mutes and %d blackouts\n",
+		len(result.Added), configFile, len(result.Skipped), result.Mutes, result.Blackouts)
+	return nil
+}
+
+// handleExport returns the devices of every instance with the current mutes and blackouts as YAML
+func (m *monitor) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	m.mu.Lock()
+	fleet := m.fleet
+	m.mu.Unlock()
+
+	export, err := exportDevices(m.config, m.state, fleet, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	data, err := yaml.Marshal(export)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(data)
+}
+
+// handleImport imports an export into the running monitor: new devices are checked from the next cycle
+// on and added to the config file, mutes and blackouts are restored
+func (m *monitor) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	export, err := readExport(http.MaxBytesReader(w, r.Body, 10<<20))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	added, resolved, skipped, err := prepareImport(m.config, export, m.fleet)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := applyImport(m.configFile, m.state, export, added, skipped)
+	if len(result.Added) > 0 {
+		m.imported = append(m.imported, resolved...)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Printf("Imported %d devices through the API by %s\n", len(result.Added), requestToken(r).Name)
+	writeJSON(w, result)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TLSFingerprint holds the details of a TLS handshake that identify the device answering it
+type TLSFingerprint struct {
+	CertSHA256  string    `json:"cert_sha256"`
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	Version     string    `json:"version"`
+	CipherSuite string    `json:"cipher_suite"`
+	ALPN        string    `json:"alpn,omitempty"`
+	SeenAt      time.Time `json:"seen_at"`
+}
+
+// fingerprintRecorder probes the TLS ports of devices and alerts when the recorded handshake changes.
+// Handshakes run in Run, beside the check cycle, which picks up the changes found with Drain.
+type fingerprintRecorder struct {
+	path      string
+	interval  time.Duration
+	lastCheck map[string]time.Time
+	records   map[string]TLSFingerprint
+
+	alertQueue
+}
+
+// newFingerprintRecorder loads the fingerprints persisted in path, if any
+func newFingerprintRecorder(path string, interval time.Duration) (*fingerprintRecorder, error) {
+	if path == "" {
+		path = "fingerprints.json"
+	}
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	r := &fingerprintRecorder{
+		path:      path,
+		interval:  interval,
+		lastCheck: make(map[string]time.Time),
+		records:   make(map[string]TLSFingerprint),
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read fingerprint file: %w", err)
+	}
+	if err := json.Unmarshal(data, &r.records); err != nil {
+		return nil, fmt.Errorf("could not parse fingerprint file: %w", err)
+	}
+	return r, nil
+}
+
+// Run fingerprints the devices returned by devices whenever their check is due, so a hanging handshake
+// never delays the probes of the check cycle
+func (r *fingerprintRecorder) Run(devices func() []Device) {
+	r.runChecks(min(r.interval, time.Minute), devices, r.Check)
+}
+
+// Check fingerprints the TLS ports of the device if due and returns a line for every handshake
+// that no longer matches the persisted one
+func (r *fingerprintRecorder) Check(device Device) []string {
+	if len(device.TLSPorts) == 0 {
+		return nil
+	}
+	if last, ok := r.lastCheck[device.IP]; ok && time.Since(last) < r.interval {
+		return nil
+	}
+	r.lastCheck[device.IP] = time.Now()
+
+	var changes []string
+	updated := false
+	for _, port := range device.TLSPorts {
+		addr := net.JoinHostPort(device.IP, strconv.Itoa(port))
+		current, err := fingerprintTLS(device.Group, addr)
+		if err != nil {
+			fmt.Printf("TLS fingerprint of %s failed: %v\n", addr, err)
+			continue
+		}
+
+		previous, known := r.records[addr]
+		if known && previous.CertSHA256 == current.CertSHA256 && previous.handshake() == current.handshake() {
+			continue
+		}
+		if known {
+			changes = append(changes, fmt.Sprintf("⚠️ %s (%s): TLS fingerprint changed on port %d\n    was: %s %s\n    now: %s %s",
+				device.Description, device.IP, port, previous.CertSHA256[:16], previous.handshake(), current.CertSHA256[:16], current.handshake()))
+		}
+		r.records[addr] = current
+		updated = true
+	}
+
+	if updated {
+		if err := r.save(); err != nil {
+			fmt.Printf("Error saving TLS fingerprints: %v\n", err)
+		}
+	}
+	return changes
+}
+
+func (r *fingerprintRecorder) save() error {
+	data, err := json.MarshalIndent(r.records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode fingerprints: %w", err)
+	}
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("could not write fingerprint file: %w", err)
+	}
+	return os.Rename(tmp, r.path)
+}
+
+// handshake summarizes the negotiated parameters, a rough stand-in for a JA3S hash
+func (f TLSFingerprint) handshake() string {
+	parts := []string{f.Version, f.CipherSuite}
+	if f.ALPN != "" {
+		parts = append(parts, f.ALPN)
+	}
+	return strings.Join(parts, "/")
+}
+
+// fingerprintTLS performs a TLS handshake with addr and records the leaf certificate and negotiated parameters.
+// Certificates are not verified: devices commonly use self-signed ones and only changes matter here.
+func fingerprintTLS(group, addr string) (TLSFingerprint, error) {
+	raw, err := dialProbe(group, addr, 5*time.Second)
+	if err != nil {
+		return TLSFingerprint{}, err
+	}
+	raw.SetDeadline(time.Now().Add(5 * time.Second))
+	conn := tls.Client(raw, &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2", "http/1.1"},
+	})
+	defer conn.Close()
+	if err := conn.Handshake(); err != nil {
+		return TLSFingerprint{}, err
+	}
+
+	state := conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return TLSFingerprint{}, fmt.Errorf("no certificate presented")
+	}
+	leaf := state.PeerCertificates[0]
+	sum := sha256.Sum256(leaf.Raw)
+
+	return TLSFingerprint{
+		CertSHA256:  hex.EncodeToString(sum[:]),
+		Subject:     leaf.Subject.String(),
+		Issuer:      leaf.Issuer.String(),
+		Version:     tls.VersionName(state.Version),
+		CipherSuite: tls.CipherSuiteName(state.CipherSuite),
+		ALPN:        state.NegotiatedProtocol,
+		SeenAt:      time.Now(),
+	}, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import "time"
+
+// FlappingConfig defines when a device is considered flapping
+type FlappingConfig struct {
+	Changes int      `yaml:"changes"` // More state changes than this within Window mean flapping; 0 disables detection
+	Window  Duration `yaml:"window"`  // Default 10m
+	Stable  Duration `yaml:"stable"`  // How long a flapping device must keep one state to be stable again (default 10m)
+}
+
+// flapDetector tracks probe state changes per device and holds devices in the flapping state while they are unstable
+type flapDetector struct {
+	config     FlappingConfig
+	changes    map[string][]time.Time
+	lastChange map[string]time.Time // Kept apart from changes, which only covers Window
+	lastProbe  map[string]DeviceState
+	flapping   map[string]bool
+}
+
+func newFlapDetector(config FlappingConfig) *flapDetector {
+	if config.Window <= 0 {
+		config.Window = Duration(10 * time.Minute)
+	}
+	if config.Stable <= 0 {
+		config.Stable = Duration(10 * time.Minute)
+	}
+	return &flapDetector{
+		config:     config,
+		changes:    make(map[string][]time.Time),
+		lastChange: make(map[string]time.Time),
+		lastProbe:  make(map[string]DeviceState),
+		flapping:   make(map[string]bool),
+	}
+}
+
+// Update records the probe result of a device and returns the state to use for it:
+// StateFlapping while it is unstable, otherwise the probe result itself
+func (d *flapDetector) Update(ip string, probe DeviceState, now time.Time) DeviceState {
+	if d.config.Changes <= 0 {
+		return probe
+	}
+
+	if last, ok := d.lastProbe[ip]; ok && last != probe {
+		d.changes[ip] = append(d.changes[ip], now)
+		d.lastChange[ip] = now
+	}
+	d.lastProbe[ip] = probe
+
+	// Forget changes that fell out of the window
+	changes := d.changes[ip]
+	cutoff := now.Add(-d.config.Window.Duration())
+	for len(changes) > 0 && changes[0].Before(cutoff) {
+		changes = changes[1:]
+	}
+	d.changes[ip] = changes
+
+	if !d.flapping[ip] {
+		if len(changes) > d.config.Changes {
+			d.flapping[ip] = true
+			return StateFlapping
+		}
+		return probe
+	}
+
+	// A flapping device is stable again once it kept its state long enough, even if Stable is longer than Window
+	if now.Sub(d.lastChange[ip]) >= d.config.Stable.Duration() {
+		d.flapping[ip] = false
+		d.changes[ip] = nil
+		return probe
+	}
+	return StateFlapping
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+
+	_ "github.com/lib/pq"
+)
+
+// historyStore persists the results of every cycle
+type historyStore interface {
+	Record(snapshot CycleSnapshot, changes []StatusChange) error
+}
+
+// HistoryConfig selects the database check results are written to
+type HistoryConfig struct {
+	Backend   string `yaml:"backend"`   // Only "postgres" is supported
+	DSN       string `yaml:"dsn"`       // Connection string, defaults to the POSTGRES_DSN environment variable
+	Timescale bool   `yaml:"timescale"` // Turn the tables into TimescaleDB hypertables
+}
+
+// postgresHistory writes check results to PostgreSQL so several instances can share one history
+type postgresHistory struct {
+	db       *sql.DB
+	instance string
+}
+
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS check_results (
+	time        TIMESTAMPTZ NOT NULL,
+	instance    TEXT NOT NULL,
+	description TEXT NOT NULL,
+	ip          TEXT NOT NULL,
+	status      TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS check_results_ip_time_idx ON check_results (ip, time DESC);
+
+CREATE TABLE IF NOT EXISTS status_changes (
+	time            TIMESTAMPTZ NOT NULL,
+	instance        TEXT NOT NULL,
+	description     TEXT NOT NULL,
+	ip              TEXT NOT NULL,
+	status          TEXT NOT NULL,
+	previous_status TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS status_changes_ip_time_idx ON status_changes (ip, time DESC);
+
+CREATE TABLE IF NOT EXISTS throughput_results (
+	time     TIMESTAMPTZ NOT NULL,
+	instance TEXT NOT NULL,
+	method   TEXT NOT NULL,
+	target   TEXT NOT NULL,
+	mbps     DOUBLE PRECISION NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS device_notes (
+	time        TIMESTAMPTZ NOT NULL,
+	instance    TEXT NOT NULL,
+	description TEXT NOT NULL,
+	ip          TEXT NOT NULL,
+	status      TEXT NOT NULL,
+	author      TEXT NOT NULL,
+	note        TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS device_notes_ip_time_idx ON device_notes (ip, time DESC);
+`
+
+// timeSeriesTables are the tables keyed by their time column. A table added to the schema belongs here too,
+// so it becomes a hypertable with TimescaleDB.
+var timeSeriesTables = []string{"check_results", "status_changes", "throughput_results", "device_notes"}
+
+// setupTimescale turns every time-series table into a hypertable; existing rows are migrated
+func setupTimescale(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE EXTENSION IF NOT EXISTS timescaledb`); err != nil {
+		return err
+	}
+	for _, table := range timeSeriesTables {
+		stmt := fmt.Sprintf(`SELECT create_hypertable('%s', 'time', if_not_exists => TRUE, migrate_data => TRUE)`, table)
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("%s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// newHistoryStore connects to the configured history backend and makes sure its schema exists
+func newHistoryStore(config *HistoryConfig, instance string) (historyStore, error) {
+	if config.Backend != "postgres" {
+		return nil, fmt.Errorf("unsupported history backend %q", config.Backend)
+	}
+
+	dsn := config.DSN
+	if dsn == "" {
+		dsn = os.Getenv("POSTGRES_DSN")
+	}
+	if dsn == "" {
+		return nil, fmt.Errorf("history dsn or POSTGRES_DSN environment variable is required")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("could not open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not connect to database: %w", err)
+	}
+
+	if _, err := db.Exec(postgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not create schema: %w", err)
+	}
+	if config.Timescale {
+		if err := setupTimescale(db); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("could not set up TimescaleDB: %w", err)
+		}
+	}
+
+	return &postgresHistory{db: db, instance: instance}, nil
+}
+
+// Record inserts the results and status changes of a cycle in one transaction
+func (h *postgresHistory) Record(snapshot CycleSnapshot, changes []StatusChange) error {
+	tx, err := h.db.Begin()
+	if err != nil {
+		return fmt.Errorf("could not begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, result := range snapshot.Results {
+		_, err := tx.Exec(`INSERT INTO check_results (time, instance, description, ip, status) VALUES ($1, $2, $3, $4, $5)`,
+			snapshot.Time, h.instance, result.Description, result.IP, string(result.State))
+		if err != nil {
+			return fmt.Errorf("could not insert check result: %w", err)
+		}
+	}
+	for _, change := range changes {
+		_, err := tx.Exec(`INSERT INTO status_changes (time, instance, description, ip, status, previous_status) VALUES ($1, $2, $3, $4, $5, $6)`,
+			change.Time, h.instance, change.Description, change.IP, string(change.State), string(change.PreviousState))
+		if err != nil {
+			return fmt.Errorf("could not insert status change: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("could not commit history: %w", err)
+	}
+	return nil
+}
+
+// RecordThroughput inserts a speed test result
+func (h *postgresHistory) RecordThroughput(result ThroughputResult) error {
+	_, err := h.db.Exec(`INSERT INTO throughput_results (time, instance, method, target, mbps) VALUES ($1, $2, $3, $4, $5)`,
+		result.Time, h.instance, result.Method, result.Target, result.Mbps)
+	if err != nil {
+		return fmt.Errorf("could not insert speed test result: %w", err)
+	}
+	return nil
+}
+
+// RecordNote inserts an operator note
+func (h *postgresHistory) RecordNote(note DeviceNote) error {
+	_, err := h.db.Exec(`INSERT INTO device_notes (time, instance, description, ip, status, author, note) VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		note.Time, h.instance, note.Description, note.IP, string(note.State), note.Author, note.Text)
+	if err != nil {
+		return fmt.Errorf("could not insert note: %w", err)
+	}
+	return nil
+}
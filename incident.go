@@ -0,0 +1,318 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Incident groups the outages of a period of trouble: it opens when a device goes down and
+// ends once all of its devices are up or degraded again. Devices failing meanwhile join it.
+type Incident struct {
+	ID      string          `json:"id"`
+	Start   time.Time       `json:"start"`
+	End     *time.Time      `json:"end,omitempty"`
+	Devices []string        `json:"devices"` // IPs of the affected devices
+	AckedBy string          `json:"acked_by,omitempty"`
+	Events  []IncidentEvent `json:"events"`
+}
+
+// IncidentEvent is one entry of an incident timeline
+type IncidentEvent struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"` // "state", "ack", "note", "notification" or "resolved"
+	Device string    `json:"device,omitempty"`
+	Text   string    `json:"text"`
+}
+
+// incidentTracker keeps the open incident and the ones that ended within the report retention
+type incidentTracker struct {
+	mu        sync.Mutex
+	incidents []*Incident // Oldest first, the last one may be open
+}
+
+func newIncidentTracker() *incidentTracker {
+	return &incidentTracker{}
+}
+
+// open returns the open incident, if any. The caller holds the lock.
+func (t *incidentTracker) open() *Incident {
+	if n := len(t.incidents); n > 0 && t.incidents[n-1].End == nil {
+		return t.incidents[n-1]
+	}
+	return nil
+}
+
+// Update adds the status changes of a cycle to the timeline, opening and resolving incidents
+func (t *incidentTracker) Update(changes []StatusChange, results []DeviceResult, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, change := range changes {
+		incident := t.open()
+		if change.State == StateDown {
+			if incident == nil {
+				id := make([]byte, 3)
+				rand.Read(id)
+				incident = &Incident{ID: hex.EncodeToString(id), Start: change.Time}
+				t.incidents = append(t.incidents, incident)
+			}
+			if !incident.affects(change.IP) {
+				incident.Devices = append(incident.Devices, change.IP)
+			}
+		}
+		if incident != nil && incident.affects(change.IP) {
+			incident.Events = append(incident.Events, IncidentEvent{
+				Time:   change.Time,
+				Kind:   "state",
+				Device: change.Description,
+				Text:   fmt.Sprintf("%s → %s", change.PreviousState, change.State),
+			})
+		}
+	}
+
+	if incident := t.open(); incident != nil {
+		for _, result := range results {
+			// A device that went from down to flapping, muted or maintenance is not healthy yet
+			if !result.State.Recovered() && incident.affects(result.IP) {
+				return
+			}
+		}
+		incident.End = &now
+		incident.Events = append(incident.Events, IncidentEvent{Time: now, Kind: "resolved", Text: "All devices recovered"})
+	}
+
+	cutoff := now.Add(-reportRetention)
+	for len(t.incidents) > 0 && t.incidents[0].End != nil && t.incidents[0].End.Before(cutoff) {
+		t.incidents = t.incidents[1:]
+	}
+}
+
+func (i *Incident) affects(ip string) bool {
+	for _, device := range i.Devices {
+		if device == ip {
+			return true
+		}
+	}
+	return false
+}
+
+// Ack acknowledges an incident, the open one if id is empty
+func (t *incidentTracker) Ack(id, by string) (Incident, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	incident := t.open()
+	if id != "" {
+		incident = nil
+		for _, i := range t.incidents {
+			if i.ID == id {
+				incident = i
+			}
+		}
+	}
+	if incident == nil {
+		if id == "" {
+			return Incident{}, fmt.Errorf("no open incident")
+		}
+		return Incident{}, fmt.Errorf("incident %s not found", id)
+	}
+	if incident.AckedBy == "" {
+		incident.AckedBy = by
+		incident.Events = append(incident.Events, IncidentEvent{Time: time.Now(), Kind: "ack", Text: "Acknowledged by " + by})
+	}
+	return incident.copy(), nil
+}
+
+// AddNote adds a note to the timeline of the open incident if it affects the device
+func (t *incidentTracker) AddNote(note DeviceNote) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if incident := t.open(); incident != nil && incident.affects(note.IP) {
+		incident.Events = append(incident.Events, IncidentEvent{
+			Time:   note.Time,
+			Kind:   "note",
+			Device: note.Description,
+			Text:   fmt.Sprintf("%s (%s)", note.Text, note.Author),
+		})
+	}
+}
+
+// Notified records a notification about a device in the open incident
+func (t *incidentTracker) Notified(ip, channel string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if incident := t.open(); incident != nil && incident.affects(ip) {
+		incident.Events = append(incident.Events, IncidentEvent{Time: at, Kind: "notification", Text: "Sent to " + channel})
+	}
+}
+
+// Since returns copies of the incidents that were open at some point after from, newest first
+func (t *incidentTracker) Since(from time.Time) []Incident {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var incidents []Incident
+	for i := len(t.incidents) - 1; i >= 0; i-- {
+		incident := t.incidents[i]
+		if incident.End == nil || !incident.End.Before(from) {
+			incidents = append(incidents, incident.copy())
+		}
+	}
+	return incidents
+}
+
+// Get returns a copy of an incident
+func (t *incidentTracker) Get(id string) (Incident, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, incident := range t.incidents {
+		if incident.ID == id {
+			return incident.copy(), true
+		}
+	}
+	return Incident{}, false
+}
+
+// copy detaches an incident from the tracker so it can be used without the lock
+func (i *Incident) copy() Incident {
+	c := *i
+	c.Devices = append([]string(nil), i.Devices...)
+	c.Events = append([]IncidentEvent(nil), i.Events...)
+	if i.End != nil {
+		end := *i.End
+		c.End = &end
+	}
+	return c
+}
+
+// Duration returns how long the incident lasted, or has lasted so far
+func (i Incident) Duration(now time.Time) time.Duration {
+	if i.End != nil {
+		return i.End.Sub(i.Start)
+	}
+	return now.Sub(i.Start)
+}
+
+// formatIncidents renders incidents as a chat message section
+func formatIncidents(incidents []Incident, devices []Device, now time.Time) string {
+	var b strings.Builder
+	for _, incident := range incidents {
+		names := make([]string, 0, len(incident.Devices))
+		for _, ip := range incident.Devices {
+			if device, ok := findDevice(devices, ip); ok {
+				names = append(names, device.Description)
+			} else {
+				names = append(names, ip)
+			}
+		}
+		status := "ongoing"
+		if incident.End != nil {
+			status = "resolved"
+		}
+		fmt.Fprintf(&b, "#%s %s, %s, %s: %s", incident.ID, incident.Start.Format("Jan 2 15:04"), status,
+			incident.Duration(now).Round(time.Second), strings.Join(names, ", "))
+		if incident.AckedBy != "" {
+			fmt.Fprintf(&b, " (acked by %s)", incident.AckedBy)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// groupIncidents returns the incidents since from that affected a device of group, or all of them if group is empty
+func (m *monitor) groupIncidents(from time.Time, group string) []Incident {
+	incidents := m.incidents.Since(from)
+	if group == "" {
+		return incidents
+	}
+	devices := m.Devices()
+	var filtered []Incident
+	for _, incident := range incidents {
+		for _, ip := range incident.Devices {
+			if device, ok := findDevice(devices, ip); ok && device.Group == group {
+				filtered = append(filtered, incident)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// incidentsCommand lists the incidents of the last 24 hours
+func (m *monitor) incidentsCommand() string {
+	now := time.Now()
+	incidents := m.incidents.Since(now.Add(-24 * time.Hour))
+	if len(incidents) == 0 {
+		return "No incidents in the last 24 hours"
+	}
+	return "🧾 Incidents, last 24h\n\n" + formatIncidents(incidents, m.Devices(), now)
+}
+
+// ackIncident acknowledges an incident and records the ack of its devices in the state store, so replicas
+// sharing state stop escalating them too
+func (m *monitor) ackIncident(id, by string) (Incident, error) {
+	incident, err := m.incidents.Ack(id, by)
+	if err != nil {
+		return incident, err
+	}
+	for _, ip := range incident.Devices {
+		if err := m.state.Ack(ip, incident.AckedBy); err != nil {
+			return incident, fmt.Errorf("could not store ack: %w", err)
+		}
+	}
+	return incident, nil
+}
+
+// ackCommand handles "/ack [incident id]"
+func (m *monitor) ackCommand(args []string, author string) string {
+	id := ""
+	if len(args) > 0 {
+		id = strings.TrimPrefix(args[0], "#")
+	}
+	incident, err := m.ackIncident(id, author)
+	if err != nil {
+		return err.Error()
+	}
+	return fmt.Sprintf("✅ Incident #%s acknowledged by %s, escalation stopped", incident.ID, incident.AckedBy)
+}
+
+// handleIncidents lists the incidents of the report retention
+func (m *monitor) handleIncidents(w http.ResponseWriter, r *http.Request) {
+	incidents := m.incidents.Since(time.Now().Add(-reportRetention))
+	if incidents == nil {
+		incidents = []Incident{}
+	}
+	writeJSON(w, incidents)
+}
+
+// handleIncident returns one incident (GET) or acknowledges it (POST .../ack, write scope)
+func (m *monitor) handleIncident(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/incidents/"), "/")
+	switch {
+	case r.Method == http.MethodGet && action == "":
+		incident, ok := m.incidents.Get(id)
+		if !ok {
+			http.Error(w, "unknown incident", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, incident)
+	case r.Method == http.MethodPost && action == "ack":
+		token := requestToken(r)
+		if !token.HasScope(scopeWrite) {
+			http.Error(w, fmt.Sprintf("token lacks the %s scope", scopeWrite), http.StatusForbidden)
+			return
+		}
+		incident, err := m.ackIncident(id, token.Name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, incident)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
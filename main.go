@@ -3,10 +3,12 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-ping/ping"
@@ -16,20 +18,125 @@ import (
 
 // Device struct with description and IP
 type Device struct {
-	Description string `yaml:"description"`
-	IP          string `yaml:"ip"`
+	Description   string `yaml:"description,omitempty"`
+	IP            string `yaml:"ip,omitempty"`
+	Ports         []int  `yaml:"ports,omitempty"`          // Ports watched for changes by the port scan
+	ExpectedPorts []int  `yaml:"expected_ports,omitempty"` // Ports that must stay open
+	TLSPorts      []int  `yaml:"tls_ports,omitempty"`      // Ports whose TLS fingerprint is recorded
+	Group         string `yaml:"group,omitempty"`
+	DependsOn     string `yaml:"depends_on,omitempty"` // Description or IP of the upstream switch/router
+	Severity      string `yaml:"severity,omitempty"`   // "info", "warning" (default) or "critical"; critical devices get a ticket when they stay down
+	Escalation    string `yaml:"escalation,omitempty"` // Name of the escalation policy, overrides the one of the group
+	Confirm       string `yaml:"confirm,omitempty"`    // Secondary probe before declaring the device down: "tcp:<port>" or "arp"
+	Scope         string `yaml:"scope,omitempty"`      // "lan" or "wan", by default derived from the address
+
+	Site     string    `yaml:"site,omitempty"`     // Name of an entry in sites, where the device is shown on the dashboard map
+	Location *Location `yaml:"location,omitempty"` // Coordinates of a device not at a configured site
+
+	Interval Duration `yaml:"interval,omitempty"` // How often the device is checked, default 30s
+	Timeout  Duration `yaml:"timeout,omitempty"`  // How long a check may take, default 5s
+	Count    int      `yaml:"count,omitempty"`    // Pings per check, default 3
+	Probe    string   `yaml:"probe,omitempty"`    // "icmp" (default), "tcp:<port>", "relay" or "synthetic"
+	Profile  string   `yaml:"profile,omitempty"`  // Name of the profile providing the settings not set here
+
+	DegradedRTT  Duration            `yaml:"degraded_rtt,omitempty"`  // Average RTT above which the device is degraded
+	ExpectedDown bool                `yaml:"expected_down,omitempty"` // Being unreachable is normal, e.g. a laptop or a device switched off at night
+	Maintenance  []MaintenanceWindow `yaml:"maintenance,omitempty"`
+	Outage       *MaintenanceWindow  `yaml:"outage,omitempty"` // When a synthetic device reports down, e.g. Tuesdays 10:00-10:15
 }
 
 // Config struct for reading devices from the YAML file
 type Config struct {
-	UseTelegram bool     `yaml:"use_telegram"`
-	Devices     []Device `yaml:"devices"`
+	Devices  []Device               `yaml:"devices"`
+	Defaults Device                 `yaml:"defaults"` // Settings inherited by devices that do not set them
+	Profiles map[string]Device      `yaml:"profiles"` // Named presets for device classes, e.g. "camera"
+	Groups   map[string]GroupConfig `yaml:"groups"`
+	Sites    map[string]Location    `yaml:"sites"`
+	DNSSync  *DNSSync               `yaml:"dns_sync"`
+
+	TopologyInference TopologyInference `yaml:"topology_inference"`
+	ProbeBudget       *ProbeBudget      `yaml:"probe_budget"`
+	Uplink            UplinkConfig      `yaml:"uplink"`
+	PublicIP          PublicIPConfig    `yaml:"public_ip"`
+	Speedtest         *SpeedtestConfig  `yaml:"speedtest"`
+
+	UseTelegram      bool `yaml:"use_telegram"`
+	TelegramCommands bool `yaml:"telegram_commands"` // Answer bot commands such as /report
+	// Telegram user IDs or @usernames allowed to run bot commands; empty allows everyone in the chat
+	TelegramAllowedUsers []string `yaml:"telegram_allowed_users"`
+	TelegramMinSeverity  string   `yaml:"telegram_min_severity"` // Least severity of the devices announced in the chat
+
+	Chats        []ChatConfig       `yaml:"chats"` // Mattermost and Rocket.Chat
+	PublicStatus PublicStatusConfig `yaml:"public_status"`
+	Digest       *DigestConfig      `yaml:"digest"`
+
+	// Device states that trigger a notification when entered; unlisted states use the defaults (up, degraded, down, flapping)
+	NotifyStates map[DeviceState]bool `yaml:"notify_states"`
+	Flapping     FlappingConfig       `yaml:"flapping"`
+
+	PortScanInterval Duration `yaml:"port_scan_interval"`
+
+	FingerprintFile     string   `yaml:"fingerprint_file"`
+	FingerprintInterval Duration `yaml:"fingerprint_interval"`
+
+	Webhooks           []Webhook                   `yaml:"webhooks"`
+	EscalationPolicies map[string][]EscalationStep `yaml:"escalation_policies"`
+	Ticketing          *TicketingConfig            `yaml:"ticketing"`
+
+	Archive  *ArchiveConfig  `yaml:"archive"`
+	History  *HistoryConfig  `yaml:"history"`
+	EventLog *EventLogConfig `yaml:"event_log"` // Windows only
+
+	SelfMonitoring *SelfMonitoringConfig `yaml:"self_monitoring"`
+	UpdateCheck    *UpdateCheckConfig    `yaml:"update_check"`
+	Chaos          *ChaosConfig          `yaml:"chaos"` // Staging only: fake failures and latency
+	State          *StateConfig          `yaml:"state"`
+	API            *APIConfig            `yaml:"api"`
+	Reload         ReloadConfig          `yaml:"reload"`
+
+	Instance string `yaml:"instance"` // Name of this monitor instance, defaults to the hostname
+}
+
+// Duration is a time.Duration that can be written as "30s" or "5m" in YAML
+type Duration time.Duration
+
+// UnmarshalYAML parses durations written in time.ParseDuration format
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalYAML writes durations in the format they are read in
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.Duration().String(), nil
+}
+
+// Duration returns the value as a time.Duration
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
 }
 
 // TelegramMessage struct to format the message payload
 type TelegramMessage struct {
-	ChatID string `json:"chat_id"`
-	Text   string `json:"text"`
+	ChatID   string           `json:"chat_id"`
+	Text     string           `json:"text"`
+	Entities []telegramEntity `json:"entities,omitempty"`
+}
+
+// telegramEntity marks up part of a message text; offsets and lengths count UTF-16 code units
+type telegramEntity struct {
+	Type   string        `json:"type"`
+	Offset int           `json:"offset"`
+	Length int           `json:"length"`
+	User   *telegramUser `json:"user,omitempty"` // For "text_mention"
 }
 
 // readConfig reads the devices.yaml file and parses the devices with descriptions and IPs
@@ -43,43 +150,52 @@ func readConfig(filename string) (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("could not unmarshal config: %w", err)
 	}
+	config.Devices, err = config.resolveDevices(config.Devices)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDuplicateIPs(config.Devices); err != nil {
+		return nil, err
+	}
+	if err := config.validateSeverities(); err != nil {
+		return nil, err
+	}
 	return config, nil
 }
 
-// icmpPing pings a single device using ICMP
-func icmpPing(ip string) bool {
+// icmpPingStats pings a single host using ICMP and returns the packet and RTT statistics
+func icmpPingStats(ip string, count int, timeout time.Duration) (*ping.Statistics, error) {
 	pinger, err := ping.NewPinger(ip)
 	if err != nil {
-		fmt.Printf("Failed to create pinger: %v\n", err)
-		return false
+		return nil, fmt.Errorf("failed to create pinger: %w", err)
 	}
-	pinger.Count = 3
-	pinger.Timeout = 5 * time.Second
+	pinger.Count = count
+	pinger.Timeout = timeout
 	pinger.SetPrivileged(true) // Required for Windows; on Linux, it's needed to run as root or with sudo
 
-	err = pinger.Run()
-	if err != nil {
-		fmt.Printf("Ping failed: %v\n", err)
-		return false
+	if err := pinger.Run(); err != nil {
+		return nil, err
 	}
-	stats := pinger.Statistics()
-	return stats.PacketsRecv > 0
+	return pinger.Statistics(), nil
 }
 
 // sendTelegramMessage sends a message to the specified Telegram chat
 func sendTelegramMessage(botToken, chatID, message string) error {
+	return sendTelegram(botToken, TelegramMessage{ChatID: chatID, Text: message})
+}
+
+// sendTelegram sends a message that may carry entities such as mentions
+func sendTelegram(botToken string, msg TelegramMessage) error {
 	url := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", botToken)
-	msg := TelegramMessage{
-		ChatID: chatID,
-		Text:   message,
-	}
 
 	jsonData, err := json.Marshal(msg)
 	if err != nil {
 		return fmt.Errorf("could not encode message to JSON: %w", err)
 	}
 
+	start := time.Now()
 	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	recordTelegramLatency(time.Since(start))
 	if err != nil {
 		return fmt.Errorf("could not send message to Telegram: %w", err)
 	}
@@ -92,59 +208,303 @@ func sendTelegramMessage(botToken, chatID, message string) error {
 	return nil
 }
 
-// monitorDevices pings each device every 30 seconds, prints their statuses in a table, and sends a Telegram notification on status change (if enabled)
-func monitorDevices(config *Config, botToken, chatID string) {
-	statuses := make(map[string]string)
+// monitor holds what the check loop needs, plus the runtime state shared with bot commands
+type monitor struct {
+	config       *Config
+	shard        *shard
+	state        stateStore
+	fingerprints *fingerprintRecorder
+	stores       []historyStore
+	syncer       *dnsSyncer
+	inferrer     *dependencyInferrer
+	scanner      *portScanner
+	uptime       *uptimeTracker
+	flaps        *flapDetector
+	digest       *digester
+	tickets      *ticketer
+	escalations  *escalator
+	uplink       *uplinkClassifier
+	incidents    *incidentTracker
+	pacer        *probePacer // Only with a probe budget
+	botToken     string
+	chatID       string
+	// Read-only bot/channel receiving sanitized status updates
+	publicBotToken string
+	publicChatID   string
+
+	// Only used by the check loop
+	nextCheck map[string]time.Time    // By IP, when the device is due again
+	results   map[string]DeviceResult // By IP, the latest result
+
+	configFile string // Where imported devices are added and reloads read from
+
+	mu           sync.Mutex
+	configured   []Device       // Devices of the config file, replaced on reload
+	canary       *canaryRollout // Reload being tried on a few devices
+	devices      []Device       // Devices checked in the current cycle
+	fleet        []Device       // Devices of all instances, before sharding
+	imported     []Device       // Devices imported through the API since the start
+	lastSnapshot CycleSnapshot  // Results of the last completed cycle
+}
+
+// Devices returns the devices this instance is currently monitoring
+func (m *monitor) Devices() []Device {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.devices
+}
+
+// reachableDevices returns the devices that answered in the last completed cycle
+func (m *monitor) reachableDevices() []Device {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var reachable []Device
+	for _, result := range m.lastSnapshot.Results {
+		if device, ok := findDevice(m.devices, result.IP); ok && result.Reachable {
+			reachable = append(reachable, device)
+		}
+	}
+	return reachable
+}
+
+// selectDevices builds the device list for the next cycle
+func (m *monitor) selectDevices() []Device {
+	config := m.config
+	m.mu.Lock()
+	devices := m.configured
+	m.mu.Unlock()
+	if m.syncer != nil {
+		// Synced devices have no profile, resolving them cannot fail
+		synced, _ := config.resolveDevices(m.syncer.Devices())
+		devices = mergeDevices(devices, synced)
+	}
+	m.mu.Lock()
+	devices = mergeDevices(devices, m.imported)
+	m.fleet = devices
+	m.mu.Unlock()
+	if m.shard != nil {
+		// A fixed shard takes precedence over the automatic split between replicas
+		devices = m.shard.Devices(devices)
+	} else {
+		// Replicas sharing state split the devices between them
+		devices = ownedDevices(devices, m.state.Members(), config.Instance)
+	}
+	if m.inferrer != nil {
+		devices = m.inferrer.Apply(devices)
+	}
+
+	m.mu.Lock()
+	m.devices = devices
+	m.mu.Unlock()
+	return devices
+}
+
+// run checks each device at its interval (30 seconds by default), prints their statuses in a table, and sends a Telegram notification on status change (if enabled)
+func (m *monitor) run() {
+	config := m.config
 
 	for {
-		// Create a buffer to store the Telegram message
+		devices := m.selectDevices()
+
+		// Create a buffer to store the port and TLS alerts of the Telegram message
 		var messageBuilder strings.Builder
+		var alerts []string
 
 		// Print table header
-		fmt.Printf("\n| %-20s | %-15s | %-10s |\n", "Description", "Device IP", "Status")
-		fmt.Println("|----------------------|-----------------|--------------|")
+		fmt.Printf("\n| %-20s | %-15s | %-17s |\n", "Description", "Device IP", "State")
+		fmt.Println("|----------------------|-----------------|-------------------|")
 
 		messageChanged := false
+		var statusChanges, notifyChanges []StatusChange
+		snapshot := CycleSnapshot{Time: time.Now()}
 
-		for _, device := range config.Devices {
-			isOnline := icmpPing(device.IP)
-			status := "offline"
-			statusEmoji := "🔴  " // Red circle for offline
+		mutes, err := m.state.Mutes()
+		if err != nil {
+			fmt.Printf("Error loading mutes: %v\n", err)
+		}
+		blackouts, err := m.state.Blackouts()
+		if err != nil {
+			fmt.Printf("Error loading blackouts: %v\n", err)
+		}
 
-			if isOnline {
-				status = "online"
-				statusEmoji = "🟢  " // Green circle for online
+		probes := newCycleProbes()
+		due := m.scheduleChecks(devices, snapshot.Time, config.ProbeBudget, probes)
+		for _, device := range devices {
+			// Devices with a longer interval than the cycle, or deferred by the probe budget, keep their previous result.
+			// A device deferred before its first check, e.g. one added by a reload, is listed as unknown.
+			if !due[device.IP] {
+				previous, ok := m.results[device.IP]
+				if !ok {
+					previous = DeviceResult{Description: device.Description, IP: device.IP, State: StateUnknown}
+				}
+				snapshot.Results = append(snapshot.Results, previous)
+				continue
 			}
+			m.nextCheck[device.IP] = snapshot.Time.Add(deviceInterval(device))
 
-			fmt.Printf("| %-20s | %-15s | %s%-10s%s |\n", device.Description, device.IP, statusEmoji, status, "")
+			stats, cached, err := probes.probe(device, m.pacer)
+			if err != nil && !cached {
+				fmt.Printf("Ping failed: %v\n", err)
+			}
+			stats, injected := config.Chaos.Apply(device, stats, snapshot.Time)
+			probe := probeState(device, stats, err)
+			// An injected failure must not be undone by the confirmation probe
+			if probe == StateDown && device.Confirm != "" && !injected {
+				confirmed, err := confirmReachable(device)
+				if err != nil {
+					fmt.Printf("Confirmation probe failed for %s: %v\n", device.Description, err)
+				}
+				if confirmed {
+					fmt.Printf("%s does not answer ICMP but is reachable by %s\n", device.Description, device.Confirm)
+					probe = StateUp
+				}
+			}
+			state := deviceState(device, m.flaps.Update(device.IP, probe, snapshot.Time), blackouts, mutes[device.IP], snapshot.Time)
+			result := DeviceResult{Description: device.Description, IP: device.IP, State: state, Reachable: probe != StateDown}
+			if result.Reachable && stats != nil {
+				result.RTTMillis = float64(stats.AvgRtt.Microseconds()) / 1000
+			}
 
-			// Check if the status has changed
-			if previousStatus, exists := statuses[device.IP]; !exists || previousStatus != status {
-				// Append status to the message builder
-				messageBuilder.WriteString(fmt.Sprintf("%s Description: %s, IP: %s is %s\n", statusEmoji, device.Description, device.IP, status))
-				statuses[device.IP] = status
+			fmt.Printf("| %-20s | %-15s | %s  %-13s |\n", device.Description, device.IP, state.Emoji(), state)
+			snapshot.Results = append(snapshot.Results, result)
+			m.results[device.IP] = result
+			m.uptime.Observe(device, state, result.Reachable, snapshot.Time)
+
+			// Check if the state has changed
+			if previousState, exists := m.state.SwapState(device.IP, state); !exists || previousState != state {
+				change := StatusChange{
+					Description:   device.Description,
+					IP:            device.IP,
+					State:         state,
+					PreviousState: previousState,
+					Time:          time.Now(),
+				}
+				statusChanges = append(statusChanges, change)
+				if m.shouldNotify(change) {
+					notifyChanges = append(notifyChanges, change)
+				}
+			}
+		}
+
+		// Port and TLS drift found by the background checks since the previous cycle
+		for _, alert := range append(m.scanner.Drain(), m.fingerprints.Drain()...) {
+			fmt.Println(alert.text)
+			if meetsSeverity(alert.device, config.TelegramMinSeverity) {
+				messageBuilder.WriteString(alert.text + "\n")
 				messageChanged = true
 			}
+			alerts = append(alerts, alert.text)
 		}
 
-		// Send the message if Telegram is enabled and it's the first run or if there was a status change
-		if config.UseTelegram && (messageChanged || len(statuses) == 0) {
-			message := messageBuilder.String()
-			err := sendTelegramMessage(botToken, chatID, message)
+		m.incidents.Update(statusChanges, snapshot.Results, snapshot.Time)
+
+		chatChanges := notifyChanges
+		var uplinkMessage string
+		if m.uplink != nil {
+			// One uplink alert replaces the alerts of every internet target
+			var wan map[string]bool
+			var stillDown []StatusChange
+			uplinkMessage, wan, stillDown = m.uplink.Classify(devices, snapshot.Results, snapshot.Time)
+			chatChanges = withoutDevices(chatChanges, wan)
+			for _, change := range stillDown {
+				if m.shouldNotify(change) {
+					chatChanges = append(chatChanges, change)
+				}
+			}
+			if uplinkMessage != "" {
+				fmt.Println(uplinkMessage)
+				uplinkMessage += "\n"
+			}
+		}
+
+		// Send the message if Telegram is enabled and there was a state change worth notifying (always the case on the first run)
+		telegramChanges := filterSeverity(chatChanges, devices, config.TelegramMinSeverity)
+		if config.UseTelegram && (messageChanged || len(telegramChanges) > 0 || uplinkMessage != "") {
+			msg := TelegramMessage{ChatID: m.chatID, Text: uplinkMessage + formatStatusChanges(telegramChanges, devices, snapshot.Results) + messageBuilder.String()}
+			mentionOnCall(&msg, config.criticalOnCall(telegramChanges, devices, snapshot.Time))
+			err := recordDelivery("telegram", sendTelegram(m.botToken, msg))
 			if err != nil {
 				fmt.Printf("Error sending Telegram message: %v\n", err)
+			} else {
+				for _, change := range telegramChanges {
+					m.incidents.Notified(change.IP, "telegram", time.Now())
+				}
+			}
+		}
+
+		m.sendChats(chatChanges, uplinkMessage, alerts, devices, snapshot.Results)
+
+		if m.publicChatID != "" {
+			// Devices below min_severity are left out of the affected list too, subscribers never see them
+			min := config.PublicStatus.MinSeverity
+			if message := formatPublicStatus(config.PublicStatus.Title, filterSeverity(notifyChanges, devices, min),
+				filterResultsSeverity(snapshot.Results, devices, min)); message != "" {
+				if err := recordDelivery("public_status", sendTelegramMessage(m.publicBotToken, m.publicChatID, message)); err != nil {
+					fmt.Printf("Error sending public status message: %v\n", err)
+				}
+			}
+		}
+
+		if m.digest != nil {
+			m.digest.Add(filterSeverity(statusChanges, devices, config.Digest.MinSeverity), alerts, snapshot.Results)
+		}
+		m.escalations.Update(m, devices, snapshot.Results, snapshot.Time)
+		if m.tickets != nil {
+			m.tickets.Update(devices, snapshot.Results, m.incidents, snapshot.Time)
+		}
+
+		m.mu.Lock()
+		m.lastSnapshot = snapshot
+		m.mu.Unlock()
+
+		sendWebhooks(config.Webhooks, statusChanges, devices, snapshot)
+		for _, store := range m.stores {
+			if err := store.Record(snapshot, statusChanges); err != nil {
+				fmt.Printf("Error recording history: %v\n", err)
 			}
 		}
 
-		// Print a separator and wait 30 seconds
+		m.checkCanary(notifyChanges)
+		recordCycle(time.Since(snapshot.Time))
+		m.checkDelivery(time.Now())
+
+		// Print a separator and wait for the next cycle
 		fmt.Println("===================================")
-		time.Sleep(30 * time.Second)
+		time.Sleep(cycleInterval(devices))
 	}
 }
 
 func main() {
+	shardFlag := flag.String("shard", "", "monitor only shard `N/M` of the devices, e.g. 2/5")
+	versionFlag := flag.Bool("version", false, "print the version and exit")
+	flag.Usage = printUsage
+	flag.Parse()
+
+	if *versionFlag {
+		fmt.Printf("ping_monitor %s\n", buildInfo())
+		return
+	}
+	if ran, err := runStandaloneCommand(flag.Arg(0), flag.Args()[1:]); ran {
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	var shardSpec *shard
+	if *shardFlag != "" {
+		parsed, err := parseShard(*shardFlag)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			return
+		}
+		shardSpec = &parsed
+	}
+
 	// Load the device list from devices.yaml
-	config, err := readConfig("devices.yaml")
+	const configFile = "devices.yaml"
+	config, err := readConfig(configFile)
 	if err != nil {
 		fmt.Printf("Error reading config: %v\n", err)
 		return
@@ -152,11 +512,36 @@ func main() {
 
 	var botToken, chatID string
 
-	// Load environment variables only if Telegram is enabled
-	if config.UseTelegram {
-		err := godotenv.Load()
+	// The .env file is only required when Telegram is enabled, other settings may come from the environment
+	envErr := godotenv.Load()
+
+	if config.Instance == "" {
+		config.Instance, _ = os.Hostname()
+	}
+
+	state, err := newStateStore(config.State, config.Instance)
+	if err != nil {
+		fmt.Printf("Error setting up state store: %v\n", err)
+		return
+	}
+
+	if flag.NArg() > 0 {
+		var err error
+		if command, ok := findCommand(flag.Arg(0)); ok {
+			err = command.run(commandEnv{config: config, configFile: configFile, state: state}, flag.Args()[1:])
+		} else {
+			err = fmt.Errorf("unknown command %q, see ping_monitor -h", flag.Arg(0))
+		}
 		if err != nil {
-			fmt.Printf("Error loading .env file: %v\n", err)
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if config.UseTelegram {
+		if envErr != nil {
+			fmt.Printf("Error loading .env file: %v\n", envErr)
 			return
 		}
 
@@ -170,9 +555,207 @@ func main() {
 		}
 	}
 
+	var publicBotToken, publicChatID string
+	if config.PublicStatus.Enabled {
+		// The public channel may use its own bot so subscribers cannot interact with the ops bot
+		publicBotToken = os.Getenv("TELEGRAM_PUBLIC_BOT_TOKEN")
+		if publicBotToken == "" {
+			publicBotToken = os.Getenv("TELEGRAM_BOT_TOKEN")
+		}
+		publicChatID = os.Getenv("TELEGRAM_PUBLIC_CHAT_ID")
+
+		if publicBotToken == "" || publicChatID == "" {
+			fmt.Println("Public status bot token or chat ID is missing in the environment variables")
+			return
+		}
+	}
+
+	var digestBotToken, digestChatID string
+	if config.Digest != nil {
+		digestBotToken = os.Getenv("TELEGRAM_DIGEST_BOT_TOKEN")
+		if digestBotToken == "" {
+			digestBotToken = os.Getenv("TELEGRAM_BOT_TOKEN")
+		}
+		digestChatID = os.Getenv("TELEGRAM_DIGEST_CHAT_ID")
+
+		if digestChatID != "" && digestBotToken == "" {
+			fmt.Println("Digest bot token is missing in the environment variables")
+			return
+		}
+		if digestChatID == "" && len(config.Digest.Webhooks) == 0 {
+			fmt.Println("Digest is enabled but neither TELEGRAM_DIGEST_CHAT_ID nor digest webhooks are set")
+			return
+		}
+	}
+
+	fingerprints, err := newFingerprintRecorder(config.FingerprintFile, config.FingerprintInterval.Duration())
+	if err != nil {
+		fmt.Printf("Error loading TLS fingerprints: %v\n", err)
+		return
+	}
+
+	var stores []historyStore
+	if config.Archive != nil {
+		archive, err := newArchiver(config.Archive)
+		if err != nil {
+			fmt.Printf("Error setting up archive: %v\n", err)
+			return
+		}
+		go archive.Run()
+		stores = append(stores, archive)
+	}
+	if config.History != nil {
+		history, err := newHistoryStore(config.History, config.Instance)
+		if err != nil {
+			fmt.Printf("Error setting up history: %v\n", err)
+			return
+		}
+		stores = append(stores, history)
+	}
+	if config.EventLog != nil {
+		eventLog, err := newEventLog(config.EventLog)
+		if err != nil {
+			fmt.Printf("Error setting up event log: %v\n", err)
+			return
+		}
+		stores = append(stores, eventLog)
+	}
+
+	if err := validateChats(config.Chats); err != nil {
+		fmt.Printf("Error in chats: %v\n", err)
+		return
+	}
+	webhooks := config.Webhooks
+	if config.Digest != nil {
+		webhooks = append(append([]Webhook(nil), webhooks...), config.Digest.Webhooks...)
+	}
+	if err := validateWebhooks(webhooks); err != nil {
+		fmt.Printf("Error in webhooks: %v\n", err)
+		return
+	}
+	if err := setupProbeProxies(config.Groups); err != nil {
+		fmt.Printf("Error setting up probe proxies: %v\n", err)
+		return
+	}
+	if err := setupProbeNetworks(config.Groups); err != nil {
+		fmt.Printf("Error setting up probe networks: %v\n", err)
+		return
+	}
+	if err := setupProbeRelays(config.Groups); err != nil {
+		fmt.Printf("Error setting up probe relays: %v\n", err)
+		return
+	}
+	if err := parseOnCall(config.Groups); err != nil {
+		fmt.Printf("Error in on-call schedules: %v\n", err)
+		return
+	}
+	if config.Chaos != nil {
+		if err := config.Chaos.parse(time.Now()); err != nil {
+			fmt.Printf("Error in chaos: %v\n", err)
+			return
+		}
+	}
+	if config.SelfMonitoring != nil && !config.hasChannel(config.SelfMonitoring.Channel) {
+		fmt.Printf("Error in self_monitoring: unknown channel %q\n", config.SelfMonitoring.Channel)
+		return
+	}
+	if config.SelfMonitoring != nil {
+		trackDeliveries(config.SelfMonitoring.window())
+	}
+	if config.UpdateCheck != nil && config.UpdateCheck.Channel != "" && !config.hasChannel(config.UpdateCheck.Channel) {
+		fmt.Printf("Error in update_check: unknown channel %q\n", config.UpdateCheck.Channel)
+		return
+	}
+	escalations, err := newEscalator(config)
+	if err != nil {
+		fmt.Printf("Error in escalation policies: %v\n", err)
+		return
+	}
+
+	var tickets *ticketer
+	if config.Ticketing != nil {
+		tickets, err = newTicketer(config.Ticketing)
+		if err != nil {
+			fmt.Printf("Error setting up ticketing: %v\n", err)
+			return
+		}
+	}
+
+	m := &monitor{
+		config:       config,
+		configFile:   configFile,
+		configured:   config.Devices,
+		shard:        shardSpec,
+		state:        state,
+		fingerprints: fingerprints,
+		stores:       stores,
+		scanner:      newPortScanner(config.PortScanInterval.Duration()),
+		uptime:       newUptimeTracker(),
+		flaps:        newFlapDetector(config.Flapping),
+		tickets:      tickets,
+		escalations:  escalations,
+		incidents:    newIncidentTracker(),
+		nextCheck:    make(map[string]time.Time),
+		results:      make(map[string]DeviceResult),
+		botToken:     botToken,
+		chatID:       chatID,
+
+		publicBotToken: publicBotToken,
+		publicChatID:   publicChatID,
+	}
+	if config.DNSSync != nil {
+		// The first transfer completes before the first cycle, later ones run beside the checks
+		m.syncer = newDNSSyncer(config.DNSSync)
+		m.syncer.Sync()
+		go m.syncer.Run()
+	}
+	if config.ProbeBudget.limited() {
+		m.pacer = newProbePacer(config.ProbeBudget)
+	}
+	if config.Digest != nil {
+		m.digest = newDigester(config.Digest, digestBotToken, digestChatID)
+		go m.digest.Run()
+	}
+	if config.Uplink.Enabled {
+		m.uplink = newUplinkClassifier(&config.Uplink)
+	}
+	if config.TopologyInference.Enabled {
+		m.inferrer = newDependencyInferrer(config.TopologyInference)
+		go m.inferrer.Run(m.Devices)
+	}
+
+	if config.PublicIP.Enabled {
+		go m.watchPublicIP()
+	}
+	if config.UpdateCheck != nil {
+		go m.checkUpdates()
+	}
+	if config.Speedtest != nil {
+		if err := config.Speedtest.validate(); err != nil {
+			fmt.Printf("Error in speedtest: %v\n", err)
+			return
+		}
+		go m.runSpeedtests()
+	}
+	if config.UseTelegram && config.TelegramCommands {
+		go m.pollTelegramCommands()
+	}
+	if config.API != nil && config.API.Listen != "" {
+		go m.serveAPI(config.API.Listen)
+	}
+	go m.scanner.Run(m.reachableDevices)
+	go m.fingerprints.Run(m.reachableDevices)
+	go m.reloadOnSignal()
+	if err := m.state.Heartbeat(); err != nil {
+		fmt.Printf("Error registering replica: %v\n", err)
+	}
+	go m.heartbeat()
+
+	fmt.Printf("Starting ping_monitor %s as %s with %d devices\n", buildInfo(), config.Instance, len(config.Devices))
+
 	// Monitor all devices in a single loop
-	monitorDevices(config, botToken, chatID)
+	m.run()
 
-	// Keep the main function running (not necessary here since monitorDevices blocks)
+	// Keep the main function running (not necessary here since run blocks)
 	select {}
 }
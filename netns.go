@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// probeNetwork is where the probes of a group are sent from on a host attached to several isolated networks
+type probeNetwork struct {
+	namespace string // Linux network namespace, a name in /var/run/netns or a path
+	vrf       string // Linux VRF device the sockets are bound to
+}
+
+// probeNetworks holds the network of every group that sets one. It is filled at startup and only read afterwards.
+var probeNetworks = map[string]probeNetwork{}
+
+// setupProbeNetworks checks the namespace and VRF settings of the groups
+func setupProbeNetworks(groups map[string]GroupConfig) error {
+	for name, group := range groups {
+		if group.Namespace == "" && group.VRF == "" {
+			continue
+		}
+		if group.Namespace != "" && group.VRF != "" {
+			return fmt.Errorf("group %s: set either namespace or vrf", name)
+		}
+		if group.Proxy != nil {
+			return fmt.Errorf("group %s: a proxy cannot be combined with namespace or vrf", name)
+		}
+		network := probeNetwork{namespace: group.Namespace, vrf: group.VRF}
+		if err := network.check(); err != nil {
+			return fmt.Errorf("group %s: %w", name, err)
+		}
+		probeNetworks[name] = network
+	}
+	return nil
+}
+
+// icmpPingStatsIn pings from the network of a group
+func icmpPingStatsIn(group, ip string, count int, timeout time.Duration) (*ping.Statistics, error) {
+	network, ok := probeNetworks[group]
+	switch {
+	case !ok:
+		return icmpPingStats(ip, count, timeout)
+	case network.vrf != "":
+		return vrfPingStats(network.vrf, ip, count, timeout)
+	}
+	var stats *ping.Statistics
+	err := inNamespace(network.namespace, func() error {
+		var err error
+		stats, err = icmpPingStats(ip, count, timeout)
+		return err
+	})
+	return stats, err
+}
+
+// dialIn opens a TCP connection from the network of a group
+func dialIn(group, addr string, timeout time.Duration) (net.Conn, error) {
+	network, ok := probeNetworks[group]
+	switch {
+	case !ok:
+		return net.DialTimeout("tcp", addr, timeout)
+	case network.vrf != "":
+		dialer := &net.Dialer{Timeout: timeout, Control: bindToDevice(network.vrf)}
+		return dialer.Dial("tcp", addr)
+	}
+	var conn net.Conn
+	err := inNamespace(network.namespace, func() error {
+		var err error
+		conn, err = net.DialTimeout("tcp", addr, timeout)
+		return err
+	})
+	return conn, err
+}
@@ -0,0 +1,178 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-ping/ping"
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+	"golang.org/x/sys/unix"
+)
+
+func namespacePath(name string) string {
+	if strings.Contains(name, "/") {
+		return name
+	}
+	return filepath.Join("/var/run/netns", name)
+}
+
+// check verifies that the namespace or VRF device exists
+func (n probeNetwork) check() error {
+	if n.namespace != "" {
+		if err := unix.Access(namespacePath(n.namespace), unix.R_OK); err != nil {
+			return fmt.Errorf("network namespace %s: %w", n.namespace, err)
+		}
+		return nil
+	}
+	if _, err := net.InterfaceByName(n.vrf); err != nil {
+		return fmt.Errorf("vrf %s: %w", n.vrf, err)
+	}
+	return nil
+}
+
+// inNamespace runs fn on an OS thread switched into a network namespace. Sockets opened by fn stay in the
+// namespace and can be used from anywhere afterwards.
+func inNamespace(name string, fn func() error) error {
+	target, err := unix.Open(namespacePath(name), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("could not open network namespace %s: %w", name, err)
+	}
+	defer unix.Close(target)
+
+	done := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		original, err := unix.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()), unix.O_RDONLY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			runtime.UnlockOSThread()
+			done <- fmt.Errorf("could not open current network namespace: %w", err)
+			return
+		}
+		defer unix.Close(original)
+		if err := unix.Setns(target, unix.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			done <- fmt.Errorf("could not enter network namespace %s: %w", name, err)
+			return
+		}
+
+		result := fn()
+		// If the thread cannot be switched back it stays locked and exits with the goroutine
+		if err := unix.Setns(original, unix.CLONE_NEWNET); err == nil {
+			runtime.UnlockOSThread()
+		}
+		done <- result
+	}()
+	return <-done
+}
+
+// bindToDevice binds sockets to a VRF device, so they use its routing table
+func bindToDevice(vrf string) func(network, address string, c syscall.RawConn) error {
+	return func(_, _ string, c syscall.RawConn) error {
+		var bindErr error
+		if err := c.Control(func(fd uintptr) {
+			bindErr = unix.BindToDevice(int(fd), vrf)
+		}); err != nil {
+			return err
+		}
+		return bindErr
+	}
+}
+
+// vrfPingStats pings from inside a VRF. go-ping cannot bind its socket to a device, so this sends the echo
+// requests itself on a raw ICMP socket bound to the VRF.
+func vrfPingStats(vrf, ip string, count int, timeout time.Duration) (*ping.Statistics, error) {
+	dst, err := net.ResolveIPAddr("ip", ip)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve %s: %w", ip, err)
+	}
+	network, proto := "ip4:icmp", 1
+	var echo, reply icmp.Type = ipv4.ICMPTypeEcho, ipv4.ICMPTypeEchoReply
+	if dst.IP.To4() == nil {
+		network, proto = "ip6:ipv6-icmp", 58
+		echo, reply = ipv6.ICMPTypeEchoRequest, ipv6.ICMPTypeEchoReply
+	}
+
+	lc := net.ListenConfig{Control: bindToDevice(vrf)}
+	conn, err := lc.ListenPacket(context.Background(), network, "")
+	if err != nil {
+		return nil, fmt.Errorf("could not open ICMP socket in vrf %s: %w", vrf, err)
+	}
+	defer conn.Close()
+
+	id := rand.Intn(0xffff)
+	stats := &ping.Statistics{Addr: ip, IPAddr: dst}
+	sent := make(map[int]time.Time, count)
+	deadline := time.Now().Add(timeout)
+	conn.SetReadDeadline(deadline)
+	buf := make([]byte, 1500)
+	for seq := 0; seq < count; seq++ {
+		msg := icmp.Message{Type: echo, Body: &icmp.Echo{ID: id, Seq: seq, Data: []byte("pingGoModule")}}
+		packet, err := msg.Marshal(nil)
+		if err != nil {
+			return nil, err
+		}
+		sent[seq] = time.Now()
+		if _, err := conn.WriteTo(packet, dst); err != nil {
+			return nil, fmt.Errorf("could not send echo request: %w", err)
+		}
+		stats.PacketsSent++
+
+		// Wait for answers up to a second before the next request, like ping does
+		next := time.Now().Add(time.Second)
+		if seq == count-1 || next.After(deadline) {
+			next = deadline
+		}
+		for time.Now().Before(next) {
+			conn.SetReadDeadline(next)
+			n, peer, err := conn.ReadFrom(buf)
+			if err != nil {
+				break
+			}
+			answer, err := icmp.ParseMessage(proto, buf[:n])
+			if err != nil || answer.Type != reply || !peer.(*net.IPAddr).IP.Equal(dst.IP) {
+				continue
+			}
+			body, ok := answer.Body.(*icmp.Echo)
+			if !ok || body.ID != id {
+				continue
+			}
+			start, known := sent[body.Seq]
+			if !known {
+				continue
+			}
+			delete(sent, body.Seq)
+			stats.Rtts = append(stats.Rtts, time.Since(start))
+			stats.PacketsRecv++
+		}
+		if !time.Now().Before(deadline) {
+			break
+		}
+	}
+
+	var total time.Duration
+	for _, rtt := range stats.Rtts {
+		total += rtt
+		if stats.MinRtt == 0 || rtt < stats.MinRtt {
+			stats.MinRtt = rtt
+		}
+		stats.MaxRtt = max(stats.MaxRtt, rtt)
+	}
+	if stats.PacketsRecv > 0 {
+		stats.AvgRtt = total / time.Duration(stats.PacketsRecv)
+	}
+	if stats.PacketsSent > 0 {
+		stats.PacketLoss = float64(stats.PacketsSent-stats.PacketsRecv) / float64(stats.PacketsSent) * 100
+	}
+	return stats, nil
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// check fails: namespaces and VRFs are only available on Linux
+func (n probeNetwork) check() error {
+	return fmt.Errorf("network namespaces and VRFs are only supported on Linux")
+}
+
+func inNamespace(name string, fn func() error) error {
+	return fmt.Errorf("network namespaces are only supported on Linux")
+}
+
+func bindToDevice(vrf string) func(network, address string, c syscall.RawConn) error {
+	return func(_, _ string, _ syscall.RawConn) error {
+		return fmt.Errorf("VRFs are only supported on Linux")
+	}
+}
+
+func vrfPingStats(vrf, ip string, count int, timeout time.Duration) (*ping.Statistics, error) {
+	return nil, fmt.Errorf("VRFs are only supported on Linux")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DeviceNote is an operator annotation on a device, usually explaining an outage
+type DeviceNote struct {
+	Description string      `json:"description"`
+	IP          string      `json:"ip"`
+	State       DeviceState `json:"state"` // State of the device when the note was written
+	Text        string      `json:"text"`
+	Author      string      `json:"author"`
+	Time        time.Time   `json:"time"`
+}
+
+// noteStore is implemented by history stores that keep notes
+type noteStore interface {
+	RecordNote(note DeviceNote) error
+}
+
+// addNote attaches a note to a device and records it in the report data and history
+func (m *monitor) addNote(device Device, text, author string) DeviceNote {
+	note := DeviceNote{
+		Description: device.Description,
+		IP:          device.IP,
+		State:       StateUnknown,
+		Text:        text,
+		Author:      author,
+		Time:        time.Now(),
+	}
+	m.mu.Lock()
+	for _, result := range m.lastSnapshot.Results {
+		if result.IP == device.IP {
+			note.State = result.State
+		}
+	}
+	m.mu.Unlock()
+
+	m.uptime.AddNote(note)
+	m.incidents.AddNote(note)
+	for _, store := range m.stores {
+		if recorder, ok := store.(noteStore); ok {
+			if err := recorder.RecordNote(note); err != nil {
+				fmt.Printf("Error recording note: %v\n", err)
+			}
+		}
+	}
+	return note
+}
+
+// noteCommand handles "/note <device> <text>"
+func (m *monitor) noteCommand(args []string, author string) string {
+	device, text, ok := splitDeviceArgs(m.Devices(), args)
+	if !ok || len(text) == 0 {
+		return "Usage: /note <ip or description> <text>"
+	}
+	note := m.addNote(device, strings.Join(text, " "), author)
+	return fmt.Sprintf("📝 Note added to %s (%s)", note.Description, note.State)
+}
+
+// splitDeviceArgs finds the device named by the leading arguments, which may be a description with spaces,
+// and returns it with the remaining arguments
+func splitDeviceArgs(devices []Device, args []string) (Device, []string, bool) {
+	for i := len(args); i > 0; i-- {
+		if device, ok := findDevice(devices, strings.Join(args[:i], " ")); ok {
+			return device, args[i:], true
+		}
+	}
+	return Device{}, nil, false
+}
+
+var ipPattern = regexp.MustCompile(`\b\d{1,3}\.\d{1,3}\.\d{1,3}\.\d{1,3}\b`)
+
+// noteReply turns a reply to an alert into a note on the device the alert is about
+func (m *monitor) noteReply(alert, text, author string) string {
+	var matched []Device
+	seen := make(map[string]bool)
+	devices := m.Devices()
+	for _, ip := range ipPattern.FindAllString(alert, -1) {
+		if device, ok := findDevice(devices, ip); ok && !seen[ip] {
+			seen[ip] = true
+			matched = append(matched, device)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return ""
+	case 1:
+		note := m.addNote(matched[0], text, author)
+		return fmt.Sprintf("📝 Note added to %s (%s)", note.Description, note.State)
+	}
+	return "That message is about several devices, use /note <ip or description> <text>"
+}
+
+// handleNotes lists the notes of the report window (GET, ?device= to filter) or adds one (POST, write scope)
+func (m *monitor) handleNotes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var filter string
+		if ref := r.URL.Query().Get("device"); ref != "" {
+			device, ok := findDevice(m.Devices(), ref)
+			if !ok {
+				http.Error(w, "unknown device", http.StatusNotFound)
+				return
+			}
+			filter = device.IP
+		}
+		notes := m.uptime.Notes(filter, time.Now().Add(-reportRetention))
+		if notes == nil {
+			notes = []DeviceNote{}
+		}
+		writeJSON(w, notes)
+	case http.MethodPost:
+		token := requestToken(r)
+		if !token.HasScope(scopeWrite) {
+			http.Error(w, fmt.Sprintf("token lacks the %s scope", scopeWrite), http.StatusForbidden)
+			return
+		}
+		var request struct {
+			Device string `json:"device"` // IP or description
+			Text   string `json:"text"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Text == "" {
+			http.Error(w, "expected {\"device\": ..., \"text\": ...}", http.StatusBadRequest)
+			return
+		}
+		device, ok := findDevice(m.Devices(), request.Device)
+		if !ok {
+			http.Error(w, "unknown device", http.StatusNotFound)
+			return
+		}
+		note := m.addNote(device, request.Text, token.Name)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, note)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
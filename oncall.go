@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// OnCallSchedule rotates the people of a group weekly, starting with the first one at start
+type OnCallSchedule struct {
+	Start  string         `yaml:"start"` // Handover time of the first week in local time, e.g. "2026-01-05 09:00"
+	People []OnCallPerson `yaml:"people"`
+
+	start time.Time
+}
+
+// OnCallPerson is someone in an on-call rotation
+type OnCallPerson struct {
+	Name     string `yaml:"name" json:"name"`
+	Telegram string `yaml:"telegram" json:"telegram,omitempty"` // Numeric user ID (needed for direct messages) or @username
+	Phone    string `yaml:"phone" json:"phone,omitempty"`       // Passed on to webhooks, e.g. for an SMS gateway
+}
+
+const onCallLayout = "2006-01-02 15:04"
+
+// parse validates the schedule and remembers its start time
+func (s *OnCallSchedule) parse() error {
+	if len(s.People) == 0 {
+		return fmt.Errorf("on-call schedule has no people")
+	}
+	start, err := time.ParseInLocation(onCallLayout, s.Start, time.Local)
+	if err != nil {
+		return fmt.Errorf("invalid on-call start %q, expected YYYY-MM-DD HH:MM", s.Start)
+	}
+	s.start = start
+	return nil
+}
+
+// Current returns who is on call at time t
+func (s *OnCallSchedule) Current(t time.Time) OnCallPerson {
+	const week = 7 * 24 * time.Hour
+	elapsed := t.Sub(s.start)
+	weeks := int(elapsed / week)
+	if elapsed < 0 && elapsed%week != 0 {
+		weeks-- // Round down before the start
+	}
+	n := len(s.People)
+	return s.People[((weeks%n)+n)%n]
+}
+
+// parseOnCall validates the on-call schedules of all groups
+func parseOnCall(groups map[string]GroupConfig) error {
+	for name, group := range groups {
+		if group.OnCall == nil {
+			continue
+		}
+		if err := group.OnCall.parse(); err != nil {
+			return fmt.Errorf("group %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// onCallFor returns who is on call for the group of a device
+func (c *Config) onCallFor(device Device, t time.Time) (OnCallPerson, bool) {
+	schedule := c.Groups[device.Group].OnCall
+	if schedule == nil {
+		return OnCallPerson{}, false
+	}
+	return schedule.Current(t), true
+}
+
+// criticalOnCall returns who is on call for the critical devices that went down, each person once
+func (c *Config) criticalOnCall(changes []StatusChange, devices []Device, now time.Time) []OnCallPerson {
+	var people []OnCallPerson
+	seen := make(map[string]bool)
+	for _, change := range changes {
+		device, ok := findDevice(devices, change.IP)
+		if !ok || change.State != StateDown || device.Severity != "critical" {
+			continue
+		}
+		person, ok := c.onCallFor(device, now)
+		if !ok || person.Telegram == "" || seen[person.Telegram] {
+			continue
+		}
+		seen[person.Telegram] = true
+		people = append(people, person)
+	}
+	return people
+}
+
+// mentionOnCall appends mentions of the on-call people to a message so they get notified even in a muted chat.
+// @usernames are mentioned as text, user IDs with a text_mention entity on the name.
+func mentionOnCall(msg *TelegramMessage, people []OnCallPerson) {
+	if len(people) == 0 {
+		return
+	}
+	msg.Text += "\n📟 On call: "
+	for i, person := range people {
+		if i > 0 {
+			msg.Text += ", "
+		}
+		if strings.HasPrefix(person.Telegram, "@") {
+			msg.Text += person.Telegram
+			continue
+		}
+		name := person.Name
+		if name == "" {
+			name = person.Telegram
+		}
+		if id, err := strconv.ParseInt(person.Telegram, 10, 64); err == nil {
+			msg.Entities = append(msg.Entities, telegramEntity{
+				Type:   "text_mention",
+				Offset: utf16Len(msg.Text),
+				Length: utf16Len(name),
+				User:   &telegramUser{ID: id, FirstName: name},
+			})
+		}
+		msg.Text += name
+	}
+}
+
+// utf16Len returns the length of s in UTF-16 code units, the unit of Telegram entity offsets
+func utf16Len(s string) int {
+	return len(utf16.Encode([]rune(s)))
+}
+
+// onCallCommand lists who is on call in every group with a schedule
+func (m *monitor) onCallCommand() string {
+	var names []string
+	for name, group := range m.config.Groups {
+		if group.OnCall != nil {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "No on-call schedules configured"
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	var b strings.Builder
+	for _, name := range names {
+		person := m.config.Groups[name].OnCall.Current(now)
+		fmt.Fprintf(&b, "%s: %s", name, person.Name)
+		if person.Telegram != "" {
+			fmt.Fprintf(&b, " (%s)", person.Telegram)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
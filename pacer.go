@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// probePacer spreads the checks so the probes stay within the budget at any moment, not only on average
+// over a cycle: a check waits until the probes before it have been paid off at the budgeted rate
+type probePacer struct {
+	budget *ProbeBudget
+
+	mu         sync.Mutex
+	packets    float64 // Available probes, negative while the last check is being paid off
+	bytes      float64
+	last       time.Time
+	recent     []probeSpend // Of the last minute, for the utilization
+	sentProbes int
+	sentBytes  int
+	waited     time.Duration
+	deferred   int
+}
+
+type probeSpend struct {
+	time    time.Time
+	packets int
+	bytes   int
+}
+
+func newProbePacer(budget *ProbeBudget) *probePacer {
+	return &probePacer{budget: budget, last: time.Now()}
+}
+
+// refill adds the probes and bytes earned since the last call; at most one second of budget is saved up
+func (p *probePacer) refill(now time.Time) {
+	elapsed := now.Sub(p.last).Seconds()
+	p.last = now
+	if rate := p.budget.ProbesPerSecond; rate > 0 {
+		p.packets = min(p.packets+elapsed*rate, rate)
+	}
+	if rate := float64(p.budget.BytesPerMinute) / 60; rate > 0 {
+		p.bytes = min(p.bytes+elapsed*rate, rate)
+	}
+}
+
+// Wait blocks until the budget allows a check of the device and charges it
+func (p *probePacer) Wait(device Device) {
+	packets, bytes := probeCost(device), probeBytes(device)
+
+	p.mu.Lock()
+	p.refill(time.Now())
+	var wait time.Duration
+	if rate := p.budget.ProbesPerSecond; rate > 0 && p.packets < 0 {
+		wait = time.Duration(-p.packets / rate * float64(time.Second))
+	}
+	if rate := float64(p.budget.BytesPerMinute) / 60; rate > 0 && p.bytes < 0 {
+		wait = max(wait, time.Duration(-p.bytes/rate*float64(time.Second)))
+	}
+	p.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	p.refill(now)
+	p.packets -= float64(packets)
+	p.bytes -= float64(bytes)
+	p.waited += wait
+	p.sentProbes += packets
+	p.sentBytes += bytes
+	p.recent = append(p.recent, probeSpend{time: now, packets: packets, bytes: bytes})
+}
+
+// Defer counts checks the scheduler postponed because of the budget
+func (p *probePacer) Defer(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deferred += n
+}
+
+// utilization returns the share of the budget used during the last minute, per limited resource
+func (p *probePacer) utilization(now time.Time) (packets, bytes float64) {
+	var usedPackets, usedBytes int
+	kept := p.recent[:0]
+	for _, spend := range p.recent {
+		if now.Sub(spend.time) < time.Minute {
+			kept = append(kept, spend)
+			usedPackets += spend.packets
+			usedBytes += spend.bytes
+		}
+	}
+	p.recent = kept
+	if p.budget.ProbesPerSecond > 0 {
+		packets = float64(usedPackets) / (p.budget.ProbesPerSecond * 60)
+	}
+	if p.budget.BytesPerMinute > 0 {
+		bytes = float64(usedBytes) / float64(p.budget.BytesPerMinute)
+	}
+	return packets, bytes
+}
+
+// writeMetrics appends the probe budget metrics in Prometheus text format
+func (p *probePacer) writeMetrics(b *strings.Builder) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	packets, bytes := p.utilization(time.Now())
+
+	b.WriteString("# HELP pinggo_probe_budget_utilization Share of the probe budget used during the last minute.\n")
+	b.WriteString("# TYPE pinggo_probe_budget_utilization gauge\n")
+	if p.budget.ProbesPerSecond > 0 {
+		fmt.Fprintf(b, "pinggo_probe_budget_utilization{resource=\"probes\"} %g\n", packets)
+	}
+	if p.budget.BytesPerMinute > 0 {
+		fmt.Fprintf(b, "pinggo_probe_budget_utilization{resource=\"bytes\"} %g\n", bytes)
+	}
+
+	b.WriteString("# HELP pinggo_probes_sent_total Probes sent for device checks.\n")
+	b.WriteString("# TYPE pinggo_probes_sent_total counter\n")
+	fmt.Fprintf(b, "pinggo_probes_sent_total %d\n", p.sentProbes)
+	b.WriteString("# HELP pinggo_probe_bytes_total Estimated traffic of the probes, both directions.\n")
+	b.WriteString("# TYPE pinggo_probe_bytes_total counter\n")
+	fmt.Fprintf(b, "pinggo_probe_bytes_total %d\n", p.sentBytes)
+
+	b.WriteString("# HELP pinggo_probe_pacing_wait_seconds_total Time checks waited for the probe budget.\n")
+	b.WriteString("# TYPE pinggo_probe_pacing_wait_seconds_total counter\n")
+	fmt.Fprintf(b, "pinggo_probe_pacing_wait_seconds_total %g\n", p.waited.Seconds())
+	b.WriteString("# HELP pinggo_checks_deferred_total Checks postponed to a later cycle by the probe budget.\n")
+	b.WriteString("# TYPE pinggo_checks_deferred_total counter\n")
+	fmt.Fprintf(b, "pinggo_checks_deferred_total %d\n", p.deferred)
+}
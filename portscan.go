@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// portScanner periodically scans the configured ports of each device and reports changes. Scans run in Run,
+// beside the check cycle, which picks up the changes found with Drain.
+type portScanner struct {
+	interval time.Duration
+	lastScan map[string]time.Time
+	open     map[string]map[int]bool
+
+	alertQueue
+}
+
+// deviceAlert is a drift found by a background scan, reported with the next check cycle
+type deviceAlert struct {
+	device Device
+	text   string
+}
+
+// alertQueue collects the alerts of a background check until the check cycle drains them
+type alertQueue struct {
+	mu      sync.Mutex
+	pending []deviceAlert
+}
+
+// Drain returns the alerts found since the previous call
+func (q *alertQueue) Drain() []deviceAlert {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	pending := q.pending
+	q.pending = nil
+	return pending
+}
+
+// runChecks calls check for the devices returned by devices every tick and queues what it finds. check
+// decides itself which devices are due.
+func (q *alertQueue) runChecks(tick time.Duration, devices func() []Device, check func(Device) []string) {
+	for {
+		for _, device := range devices() {
+			changes := check(device)
+			q.mu.Lock()
+			for _, change := range changes {
+				q.pending = append(q.pending, deviceAlert{device: device, text: change})
+			}
+			q.mu.Unlock()
+		}
+		time.Sleep(tick)
+	}
+}
+
+func newPortScanner(interval time.Duration) *portScanner {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	return &portScanner{
+		interval: interval,
+		lastScan: make(map[string]time.Time),
+		open:     make(map[string]map[int]bool),
+	}
+}
+
+// Run scans the devices returned by devices whenever their scan is due, so slow or filtered ports never
+// delay the probes of the check cycle
+func (s *portScanner) Run(devices func() []Device) {
+	s.runChecks(min(s.interval, time.Minute), devices, s.Check)
+}
+
+// Check scans the device if its scan is due and returns a line for every port whose state drifted:
+// ports that opened since the previous scan and expected ports that are closed
+func (s *portScanner) Check(device Device) []string {
+	if len(device.Ports) == 0 && len(device.ExpectedPorts) == 0 {
+		return nil
+	}
+	if last, ok := s.lastScan[device.IP]; ok && time.Since(last) < s.interval {
+		return nil
+	}
+	s.lastScan[device.IP] = time.Now()
+
+	open := scanPorts(device.Group, device.IP, append(append([]int{}, device.Ports...), device.ExpectedPorts...))
+	previous, scannedBefore := s.open[device.IP]
+	s.open[device.IP] = open
+
+	expected := make(map[int]bool, len(device.ExpectedPorts))
+	for _, port := range device.ExpectedPorts {
+		expected[port] = true
+	}
+
+	var changes []string
+	for _, port := range sortedPorts(open) {
+		if !open[port] {
+			if expected[port] && (!scannedBefore || previous[port]) {
+				changes = append(changes, fmt.Sprintf("⚠️ %s (%s): expected port %d is closed", device.Description, device.IP, port))
+			}
+			continue
+		}
+		if scannedBefore && !previous[port] {
+			changes = append(changes, fmt.Sprintf("⚠️ %s (%s): port %d is now open", device.Description, device.IP, port))
+		}
+	}
+	return changes
+}
+
+// scanPorts tries a TCP connection to every port and reports which ones accepted it
+func scanPorts(group, ip string, ports []int) map[int]bool {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	open := make(map[int]bool, len(ports))
+
+	for _, port := range ports {
+		wg.Add(1)
+		go func(port int) {
+			defer wg.Done()
+			conn, err := dialProbe(group, net.JoinHostPort(ip, strconv.Itoa(port)), 3*time.Second)
+			if err == nil {
+				conn.Close()
+			}
+			mu.Lock()
+			open[port] = err == nil
+			mu.Unlock()
+		}(port)
+	}
+	wg.Wait()
+
+	return open
+}
+
+func sortedPorts(ports map[int]bool) []int {
+	sorted := make([]int, 0, len(ports))
+	for port := range ports {
+		sorted = append(sorted, port)
+	}
+	sort.Ints(sorted)
+	return sorted
+}
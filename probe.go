@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// Probe defaults, used when neither the device nor the defaults block set them
+const (
+	defaultInterval = 30 * time.Second
+	defaultTimeout  = 5 * time.Second
+	defaultCount    = 3
+)
+
+// probeDevice checks a device with its configured probe and returns ping-style statistics
+func probeDevice(device Device) (*ping.Statistics, error) {
+	count := device.Count
+	if count <= 0 {
+		count = defaultCount
+	}
+	timeout := device.Timeout.Duration()
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	method, arg, _ := strings.Cut(device.Probe, ":")
+	switch method {
+	case "", "icmp":
+		return icmpPingStatsIn(device.Group, device.IP, count, timeout)
+	case "tcp":
+		return tcpPingStats(device.Group, device.IP, arg, count, timeout)
+	case "relay":
+		return relayPingStats(device, count, timeout)
+	case "synthetic":
+		return syntheticPingStats(device, count, time.Now()), nil
+	}
+	return nil, fmt.Errorf("unknown probe %q", device.Probe)
+}
+
+// cycleProbes remembers the probes sent in the current cycle, so a host listed more than once (under several
+// descriptions, or as host names resolving to the same address) is probed once and the result shared
+type cycleProbes struct {
+	results  map[string]probeResult // By probeKey
+	resolved map[string]string      // Host name -> address
+}
+
+type probeResult struct {
+	stats *ping.Statistics
+	err   error
+}
+
+func newCycleProbes() *cycleProbes {
+	return &cycleProbes{results: make(map[string]probeResult), resolved: make(map[string]string)}
+}
+
+// key identifies the probes a check of the device sends: the same target, probe and settings from the
+// same group, whose proxy, relay or network decides how the target is reached
+func (c *cycleProbes) key(device Device) string {
+	target := device.IP
+	if device.Probe != "synthetic" && net.ParseIP(target) == nil {
+		address, ok := c.resolved[target]
+		if !ok {
+			// Unresolvable names keep their own key, the probe reports the error
+			address = target
+			if addrs, err := net.LookupIP(target); err == nil && len(addrs) > 0 {
+				address = addrs[0].String()
+			}
+			c.resolved[target] = address
+		}
+		target = address
+	}
+	timeout := device.Timeout.Duration()
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return fmt.Sprintf("%s|%s|%s|%d|%s", device.Group, target, device.Probe, probeCost(device), timeout)
+}
+
+// probe checks the device unless a device with the same key was already probed this cycle
+func (c *cycleProbes) probe(device Device, pacer *probePacer) (stats *ping.Statistics, cached bool, err error) {
+	key := c.key(device)
+	if result, ok := c.results[key]; ok {
+		return result.stats, true, result.err
+	}
+	if pacer != nil {
+		pacer.Wait(device)
+	}
+	stats, err = probeDevice(device)
+	c.results[key] = probeResult{stats, err}
+	return stats, false, err
+}
+
+// tcpPingStats times count TCP connections to a port, for hosts that do not answer ICMP at all.
+// The connections go through the proxy of the group, if it has one.
+func tcpPingStats(group, ip, port string, count int, timeout time.Duration) (*ping.Statistics, error) {
+	if p, err := strconv.Atoi(port); err != nil || p <= 0 || p > 65535 {
+		return nil, fmt.Errorf("invalid probe port %q", port)
+	}
+
+	stats := &ping.Statistics{Addr: ip, PacketsSent: count}
+	var total time.Duration
+	for i := 0; i < count; i++ {
+		start := time.Now()
+		conn, err := dialProbe(group, net.JoinHostPort(ip, port), timeout/time.Duration(count))
+		if err != nil {
+			continue
+		}
+		conn.Close()
+
+		rtt := time.Since(start)
+		stats.Rtts = append(stats.Rtts, rtt)
+		stats.PacketsRecv++
+		total += rtt
+		if stats.MinRtt == 0 || rtt < stats.MinRtt {
+			stats.MinRtt = rtt
+		}
+		if rtt > stats.MaxRtt {
+			stats.MaxRtt = rtt
+		}
+	}
+	if stats.PacketsRecv > 0 {
+		stats.AvgRtt = total / time.Duration(stats.PacketsRecv)
+	}
+	stats.PacketLoss = float64(count-stats.PacketsRecv) / float64(count) * 100
+	return stats, nil
+}
+
+// deviceInterval returns how often a device is checked
+func deviceInterval(device Device) time.Duration {
+	if device.Interval > 0 {
+		return device.Interval.Duration()
+	}
+	return defaultInterval
+}
+
+// cycleInterval is the time between check cycles: the shortest device interval, so every device is checked on time
+func cycleInterval(devices []Device) time.Duration {
+	interval := defaultInterval
+	for i, device := range devices {
+		if d := deviceInterval(device); i == 0 || d < interval {
+			interval = d
+		}
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+	return interval
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/net/proxy"
+)
+
+// ProbeProxy routes the TCP probes of a group (checks, confirmations, port scans and TLS fingerprints)
+// through a SOCKS5 proxy or an SSH jump host, for devices only reachable via a bastion
+type ProbeProxy struct {
+	URL         string `yaml:"url"`          // "socks5://[user@]host:1080" or "ssh://user@bastion[:22]"
+	PasswordEnv string `yaml:"password_env"` // Environment variable with the SOCKS5 or SSH password
+	KeyFile     string `yaml:"key_file"`     // SSH private key
+	KnownHosts  string `yaml:"known_hosts"`  // Verifies the jump host, default ~/.ssh/known_hosts
+}
+
+// probeDialers holds the dialer of every group with a proxy. It is filled at startup and only read afterwards.
+var probeDialers = map[string]*probeDialer{}
+
+type probeDialer struct {
+	socks proxy.ContextDialer // For SOCKS5
+
+	sshHost   string // For SSH jump hosts
+	sshConfig *ssh.ClientConfig
+	mu        sync.Mutex
+	client    *ssh.Client // Kept open between probes, reconnected when it breaks
+}
+
+// setupProbeProxies creates the dialers of the groups that set a proxy
+func setupProbeProxies(groups map[string]GroupConfig) error {
+	for name, group := range groups {
+		if group.Proxy == nil {
+			continue
+		}
+		dialer, err := newProbeDialer(group.Proxy)
+		if err != nil {
+			return fmt.Errorf("proxy of group %s: %w", name, err)
+		}
+		probeDialers[name] = dialer
+	}
+	return nil
+}
+
+func newProbeDialer(config *ProbeProxy) (*probeDialer, error) {
+	target, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url: %w", err)
+	}
+
+	switch target.Scheme {
+	case "socks5":
+		var auth *proxy.Auth
+		if target.User != nil {
+			auth = &proxy.Auth{User: target.User.Username(), Password: os.Getenv(config.PasswordEnv)}
+		}
+		dialer, err := proxy.SOCKS5("tcp", target.Host, auth, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+		return &probeDialer{socks: dialer.(proxy.ContextDialer)}, nil
+
+	case "ssh":
+		return newSSHDialer(config, target)
+	}
+	return nil, fmt.Errorf("unsupported proxy %q, use socks5:// or ssh://", config.URL)
+}
+
+// newSSHDialer connects through an SSH server, used for jump hosts and relays
+func newSSHDialer(config *ProbeProxy, target *url.URL) (*probeDialer, error) {
+	if target.User == nil {
+		return nil, fmt.Errorf("ssh url needs a user, e.g. ssh://monitor@bastion")
+	}
+	var methods []ssh.AuthMethod
+	if config.KeyFile != "" {
+		key, err := os.ReadFile(config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read key file: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse key file: %w", err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if config.PasswordEnv != "" {
+		methods = append(methods, ssh.Password(os.Getenv(config.PasswordEnv)))
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("ssh needs key_file or password_env")
+	}
+
+	knownHostsFile := config.KnownHosts
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not read known hosts: %w", err)
+	}
+
+	host := target.Host
+	if target.Port() == "" {
+		host = net.JoinHostPort(target.Hostname(), "22")
+	}
+	return &probeDialer{
+		sshHost: host,
+		sshConfig: &ssh.ClientConfig{
+			User:            target.User.Username(),
+			Auth:            methods,
+			HostKeyCallback: hostKeys,
+			Timeout:         10 * time.Second,
+		},
+	}, nil
+}
+
+// DialContext opens a connection to addr through the proxy
+func (d *probeDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d.socks != nil {
+		return d.socks.DialContext(ctx, network, addr)
+	}
+
+	client, err := d.sshClient()
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to jump host %s: %w", d.sshHost, err)
+	}
+	conn, err := client.DialContext(ctx, network, addr)
+	var rejected *ssh.OpenChannelError
+	if err != nil && !errors.As(err, &rejected) && ctx.Err() == nil {
+		// Anything but the jump host refusing the connection means the SSH connection broke
+		d.reset(client)
+	}
+	return conn, err
+}
+
+// reset drops a broken SSH connection so the next probe reconnects
+func (d *probeDialer) reset(client *ssh.Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client == client {
+		client.Close()
+		d.client = nil
+	}
+}
+
+func (d *probeDialer) sshClient() (*ssh.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.client != nil {
+		return d.client, nil
+	}
+	client, err := ssh.Dial("tcp", d.sshHost, d.sshConfig)
+	if err != nil {
+		return nil, err
+	}
+	d.client = client
+	return client, nil
+}
+
+// dialProbe opens a TCP connection for a probe, through the proxy of the device's group if it has one,
+// otherwise from the group's network namespace or VRF
+func dialProbe(group, addr string, timeout time.Duration) (net.Conn, error) {
+	dialer, ok := probeDialers[group]
+	if !ok {
+		return dialIn(group, addr, timeout)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return dialer.DialContext(ctx, "tcp", addr)
+}
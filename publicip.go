@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// PublicIPConfig watches the public IP of the monitoring host and announces changes
+type PublicIPConfig struct {
+	Enabled  bool     `yaml:"enabled"`
+	Interval Duration `yaml:"interval"` // Default 5m
+	// Tried in order until one answers: "stun:<host>:<port>" or an HTTP(S) URL returning the address as plain text
+	Services []string `yaml:"services"`
+}
+
+var defaultIPServices = []string{"stun:stun.l.google.com:19302", "https://api.ipify.org"}
+
+// watchPublicIP looks up the public IP every interval and sends a Telegram message when it changes
+func (m *monitor) watchPublicIP() {
+	config := m.config.PublicIP
+	interval := config.Interval.Duration()
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	services := config.Services
+	if len(services) == 0 {
+		services = defaultIPServices
+	}
+
+	var current string
+	for {
+		ip, err := lookupPublicIP(services)
+		if err != nil {
+			fmt.Printf("Error looking up public IP: %v\n", err)
+		} else if current == "" {
+			fmt.Printf("Public IP is %s\n", ip)
+			current = ip
+		} else if ip != current {
+			message := fmt.Sprintf("🔁 Public IP changed from %s to %s", current, ip)
+			fmt.Println(message)
+			if m.config.UseTelegram {
+				if err := recordDelivery("telegram", sendTelegramMessage(m.botToken, m.chatID, message)); err != nil {
+					fmt.Printf("Error sending Telegram message: %v\n", err)
+				}
+			}
+			current = ip
+		}
+		time.Sleep(interval)
+	}
+}
+
+// lookupPublicIP asks the services in order and returns the first answer
+func lookupPublicIP(services []string) (string, error) {
+	var errs []string
+	for _, service := range services {
+		var ip string
+		var err error
+		if server, ok := strings.CutPrefix(service, "stun:"); ok {
+			ip, err = stunPublicIP(server)
+		} else {
+			ip, err = fetchExternalIP(service)
+		}
+		if err == nil {
+			return ip, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", service, err))
+	}
+	return "", fmt.Errorf("no service answered (%s)", strings.Join(errs, "; "))
+}
+
+const stunMagicCookie = 0x2112A442
+
+// stunPublicIP sends a STUN binding request (RFC 5389) and returns the mapped address from the response
+func stunPublicIP(server string) (string, error) {
+	conn, err := net.DialTimeout("udp", server, 3*time.Second)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+
+	request := make([]byte, 20)
+	binary.BigEndian.PutUint16(request[0:], 0x0001) // Binding request, no attributes
+	binary.BigEndian.PutUint32(request[4:], stunMagicCookie)
+	if _, err := rand.Read(request[8:20]); err != nil {
+		return "", fmt.Errorf("could not generate transaction ID: %w", err)
+	}
+	if _, err := conn.Write(request); err != nil {
+		return "", err
+	}
+
+	response := make([]byte, 1500)
+	n, err := conn.Read(response)
+	if err != nil {
+		return "", err
+	}
+	response = response[:n]
+	if n < 20 || binary.BigEndian.Uint16(response[0:]) != 0x0101 || !bytes.Equal(response[8:20], request[8:20]) {
+		return "", fmt.Errorf("unexpected STUN response")
+	}
+
+	// Attributes are type, length and a value padded to 4 bytes
+	attributes := response[20:]
+	for len(attributes) >= 4 {
+		kind := binary.BigEndian.Uint16(attributes[0:])
+		length := int(binary.BigEndian.Uint16(attributes[2:]))
+		if len(attributes) < 4+length {
+			break
+		}
+		value := attributes[4 : 4+length]
+		if (kind == 0x0020 || kind == 0x0001) && length >= 8 && value[1] == 0x01 {
+			ip := net.IP(append([]byte(nil), value[4:8]...))
+			if kind == 0x0020 {
+				// XOR-MAPPED-ADDRESS hides the address behind the magic cookie
+				cookie := make([]byte, 4)
+				binary.BigEndian.PutUint32(cookie, stunMagicCookie)
+				for i := range ip {
+					ip[i] ^= cookie[i]
+				}
+			}
+			return ip.String(), nil
+		}
+		attributes = attributes[4+(length+3)/4*4:]
+	}
+	return "", fmt.Errorf("STUN response has no IPv4 mapped address")
+}
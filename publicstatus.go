@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PublicStatusConfig enables a read-only channel for customers that only ever sees device descriptions
+type PublicStatusConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Title   string `yaml:"title"` // Heading of every post, e.g. "ACME service status"
+
+	MinSeverity string `yaml:"min_severity"` // Only announce devices at least this severe
+}
+
+// formatPublicStatus renders a sanitized status update: descriptions only, no IPs, ports or fingerprints.
+// It returns "" when nothing changed since the previous cycle.
+func formatPublicStatus(title string, changes []StatusChange, results []DeviceResult) string {
+	var updates []string
+	for _, change := range changes {
+		// The first observation of a device is not news for subscribers
+		if change.PreviousState == "" {
+			continue
+		}
+		switch change.State {
+		case StateUp:
+			updates = append(updates, fmt.Sprintf("🟢 %s is back up", change.Description))
+		case StateDegraded:
+			updates = append(updates, fmt.Sprintf("🟡 %s is degraded", change.Description))
+		case StateDown:
+			updates = append(updates, fmt.Sprintf("🔴 %s is down", change.Description))
+		}
+	}
+	if len(updates) == 0 {
+		return ""
+	}
+
+	var affected []string
+	for _, result := range results {
+		if result.State == StateDown || result.State == StateDegraded {
+			affected = append(affected, result.Description)
+		}
+	}
+
+	if title == "" {
+		title = "Status update"
+	}
+	var b strings.Builder
+	b.WriteString(title + "\n\n")
+	b.WriteString(strings.Join(updates, "\n"))
+	if len(affected) == 0 {
+		b.WriteString("\n\n✅ All systems operational")
+	} else {
+		b.WriteString("\n\nCurrently affected: " + strings.Join(affected, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ping/ping"
+	"golang.org/x/crypto/ssh"
+)
+
+// RelayConfig is a host the monitor can SSH into, e.g. a site router, to ping devices it cannot reach itself
+type RelayConfig struct {
+	ProbeProxy `yaml:",inline"` // url must be ssh://user@host
+	// Command run on the relay, with {ip}, {count} and {timeout} (whole seconds) replaced; the default
+	// works with Linux (iputils) and BusyBox ping
+	Command string `yaml:"command"`
+}
+
+const defaultRelayCommand = "ping -c {count} -w {timeout} {ip}"
+
+type probeRelay struct {
+	dialer  *probeDialer
+	command string
+}
+
+// probeRelays holds the relay of every group that has one. It is filled at startup and only read afterwards.
+var probeRelays = map[string]*probeRelay{}
+
+// setupProbeRelays connects the relay settings of the groups
+func setupProbeRelays(groups map[string]GroupConfig) error {
+	for name, group := range groups {
+		if group.Relay == nil {
+			continue
+		}
+		target, err := url.Parse(group.Relay.URL)
+		if err != nil || target.Scheme != "ssh" {
+			return fmt.Errorf("relay of group %s: url must be ssh://user@host", name)
+		}
+		dialer, err := newSSHDialer(&group.Relay.ProbeProxy, target)
+		if err != nil {
+			return fmt.Errorf("relay of group %s: %w", name, err)
+		}
+		command := group.Relay.Command
+		if command == "" {
+			command = defaultRelayCommand
+		}
+		probeRelays[name] = &probeRelay{dialer: dialer, command: command}
+	}
+	return nil
+}
+
+// relayHostname matches host names; the first character must not be "-", which ping would take for an option
+var relayHostname = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]*$`)
+
+// relayTarget reports whether the address can be passed to the relay's shell: only IP addresses and host names can
+func relayTarget(ip string) bool {
+	return net.ParseIP(ip) != nil || relayHostname.MatchString(ip)
+}
+
+// relayPingStats runs ping on the relay of the device's group and parses its summary
+func relayPingStats(device Device, count int, timeout time.Duration) (*ping.Statistics, error) {
+	relay, ok := probeRelays[device.Group]
+	if !ok {
+		return nil, fmt.Errorf("group %q has no relay", device.Group)
+	}
+	if !relayTarget(device.IP) {
+		return nil, fmt.Errorf("invalid address %q for a relay probe", device.IP)
+	}
+	seconds := int((timeout + time.Second - 1) / time.Second)
+	command := strings.NewReplacer("{ip}", device.IP, "{count}", strconv.Itoa(count), "{timeout}", strconv.Itoa(seconds)).Replace(relay.command)
+
+	output, err := relay.run(command, timeout+10*time.Second)
+	stats, parseErr := parsePingOutput(device.IP, output)
+	if parseErr != nil {
+		if err != nil {
+			return nil, fmt.Errorf("relay %s: %w", relay.dialer.sshHost, err)
+		}
+		return nil, fmt.Errorf("relay %s: %w", relay.dialer.sshHost, parseErr)
+	}
+	// ping exits with an error when nothing answered, the summary still tells what happened
+	return stats, nil
+}
+
+// run executes a command on the relay and returns its standard output
+func (r *probeRelay) run(command string, timeout time.Duration) ([]byte, error) {
+	client, err := r.dialer.sshClient()
+	if err != nil {
+		return nil, err
+	}
+	session, err := client.NewSession()
+	if err != nil {
+		r.dialer.reset(client)
+		return nil, err
+	}
+	defer session.Close()
+
+	type result struct {
+		output []byte
+		err    error
+	}
+	done := make(chan result, 1)
+	go func() {
+		output, err := session.Output(command)
+		done <- result{output, err}
+	}()
+	select {
+	case res := <-done:
+		var exit *ssh.ExitError
+		if res.err != nil && !errors.As(res.err, &exit) {
+			r.dialer.reset(client)
+		}
+		return res.output, res.err
+	case <-time.After(timeout):
+		r.dialer.reset(client)
+		return nil, fmt.Errorf("command timed out")
+	}
+}
+
+var (
+	pingTransmitted = regexp.MustCompile(`(\d+) packets transmitted, (\d+) (?:packets )?received`)
+	pingRTT         = regexp.MustCompile(`min/avg/max(?:/[a-z]+)? = ([\d.]+)/([\d.]+)/([\d.]+)`)
+)
+
+// parsePingOutput reads the summary printed by ping: packet counts and, if anything answered, min/avg/max RTT in ms
+func parsePingOutput(ip string, output []byte) (*ping.Statistics, error) {
+	counts := pingTransmitted.FindSubmatch(output)
+	if counts == nil {
+		return nil, fmt.Errorf("no ping summary in output %q", strings.TrimSpace(string(output)))
+	}
+	stats := &ping.Statistics{Addr: ip}
+	stats.PacketsSent, _ = strconv.Atoi(string(counts[1]))
+	stats.PacketsRecv, _ = strconv.Atoi(string(counts[2]))
+	if stats.PacketsSent > 0 {
+		stats.PacketLoss = float64(stats.PacketsSent-stats.PacketsRecv) / float64(stats.PacketsSent) * 100
+	}
+	if rtt := pingRTT.FindSubmatch(output); rtt != nil {
+		stats.MinRtt = parseMillis(rtt[1])
+		stats.AvgRtt = parseMillis(rtt[2])
+		stats.MaxRtt = parseMillis(rtt[3])
+	}
+	return stats, nil
+}
+
+func parseMillis(b []byte) time.Duration {
+	ms, _ := strconv.ParseFloat(string(b), 64)
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ReloadConfig controls reloading the device list on SIGHUP or POST /api/reload
+type ReloadConfig struct {
+	// Refuse reloads removing more than this share of the devices unless forced, default 20; 0 refuses any
+	// removal. Protects against a truncated or half-written devices.yaml.
+	MaxDropPercent *float64      `yaml:"max_drop_percent"`
+	Notify         bool          `yaml:"notify"` // Send the diff of every reload to the Telegram chat
+	Canary         *CanaryConfig `yaml:"canary"` // Try changed settings on a few devices first
+}
+
+// ConfigDiff lists how a reload changes the devices
+type ConfigDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"` // Device followed by the settings that changed
+}
+
+// Empty reports whether the reload changes nothing
+func (d ConfigDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+func (d ConfigDiff) String() string {
+	var b strings.Builder
+	for _, device := range d.Added {
+		fmt.Fprintf(&b, "+ %s\n", device)
+	}
+	for _, device := range d.Removed {
+		fmt.Fprintf(&b, "- %s\n", device)
+	}
+	for _, device := range d.Changed {
+		fmt.Fprintf(&b, "~ %s\n", device)
+	}
+	return b.String()
+}
+
+// diffDevices compares two device lists by IP
+func diffDevices(old, updated []Device) ConfigDiff {
+	diff := ConfigDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	before := make(map[string]Device, len(old))
+	for _, device := range old {
+		before[device.IP] = device
+	}
+	after := make(map[string]bool, len(updated))
+	for _, device := range updated {
+		after[device.IP] = true
+		previous, ok := before[device.IP]
+		if !ok {
+			diff.Added = append(diff.Added, fmt.Sprintf("%s (%s)", device.Description, device.IP))
+			continue
+		}
+		if fields := changedFields(previous, device); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, fmt.Sprintf("%s (%s): %s", device.Description, device.IP, strings.Join(fields, ", ")))
+		}
+	}
+	for _, device := range old {
+		if !after[device.IP] {
+			diff.Removed = append(diff.Removed, fmt.Sprintf("%s (%s)", device.Description, device.IP))
+		}
+	}
+	return diff
+}
+
+// changedFields returns the YAML keys of the settings that differ between two versions of a device
+func changedFields(a, b Device) []string {
+	fieldsA, fieldsB := deviceFields(a), deviceFields(b)
+	var changed []string
+	for key, value := range fieldsA {
+		if !reflect.DeepEqual(value, fieldsB[key]) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range fieldsB {
+		if _, ok := fieldsA[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+func deviceFields(device Device) map[string]interface{} {
+	fields := make(map[string]interface{})
+	data, err := yaml.Marshal(device)
+	if err == nil {
+		yaml.Unmarshal(data, &fields)
+	}
+	return fields
+}
+
+// reloadConfig reads the config file again and applies its device list. Only the devices (with the defaults
+// and profiles of the new file applied) are reloaded; sites, groups, on-call schedules and all other settings
+// keep their values from startup until a restart.
+func (m *monitor) reloadConfig(force bool) (ConfigDiff, error) {
+	diff, canaries, err := m.applyReload(force)
+	if err != nil {
+		fmt.Printf("Config reload refused: %v\n%s", err, diff)
+		m.notifyReload(fmt.Sprintf("⚠️ Config reload refused: %v\n%s", err, diff))
+		return diff, err
+	}
+	if diff.Empty() {
+		fmt.Println("Device list reloaded, no changes")
+		return diff, nil
+	}
+	message := "🔄 Device list reloaded:\n" + diff.String()
+	if canaries > 0 {
+		message = fmt.Sprintf("🐤 Device list reloaded, changed settings apply to %d canary devices first:\n%s", canaries, diff)
+	}
+	fmt.Print(message)
+	m.notifyReload(message)
+	return diff, nil
+}
+
+// applyReload replaces the configured devices and returns the number of canaries if the change is rolled out gradually
+func (m *monitor) applyReload(force bool) (ConfigDiff, int, error) {
+	config, err := readConfig(m.configFile)
+	if err != nil {
+		return ConfigDiff{}, 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// A reload during a canary rollout replaces the rollout, the new config is compared to the last promoted one
+	current := m.configured
+	if m.canary != nil {
+		current = m.canary.previous
+		m.canary = nil
+	}
+	diff := diffDevices(current, config.Devices)
+
+	maxDrop := 20.0
+	if m.config.Reload.MaxDropPercent != nil {
+		maxDrop = *m.config.Reload.MaxDropPercent
+	}
+	if old := len(current); !force && old > 0 && float64(len(diff.Removed))*100/float64(old) > maxDrop {
+		return diff, 0, fmt.Errorf("the new config removes %d of %d devices (more than %.0f%%), use --force to apply it anyway",
+			len(diff.Removed), old, maxDrop)
+	}
+	if m.escalations != nil {
+		for _, device := range config.Devices {
+			if policy := m.escalations.policyFor(device); policy != "" && m.escalations.policies[policy] == nil {
+				return diff, 0, fmt.Errorf("device %s uses unknown escalation policy %q", device.Description, policy)
+			}
+		}
+	}
+
+	// Devices imported through the API were written to the file, which now decides whether they stay
+	m.imported = nil
+	if m.config.Reload.Canary != nil {
+		rollout, devices := startCanary(m.config.Reload.Canary, current, config.Devices)
+		m.configured = devices
+		m.canary = rollout
+		if rollout != nil {
+			return diff, len(rollout.devices), nil
+		}
+		return diff, 0, nil
+	}
+	m.configured = config.Devices
+	return diff, 0, nil
+}
+
+func (m *monitor) notifyReload(message string) {
+	if !m.config.Reload.Notify || m.botToken == "" {
+		return
+	}
+	if err := recordDelivery("telegram", sendTelegramMessage(m.botToken, m.chatID, message)); err != nil {
+		fmt.Printf("Error sending Telegram message: %v\n", err)
+	}
+}
+
+// reloadOnSignal reloads the device list whenever the process receives SIGHUP
+func (m *monitor) reloadOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		m.reloadConfig(false)
+	}
+}
+
+// handleReload reloads the device list; ?force=true applies it even if it drops many devices
+func (m *monitor) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	diff, err := m.reloadConfig(r.URL.Query().Get("force") == "true")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, diff)
+}
+
+type reloadOptions struct {
+	force bool
+}
+
+func (o *reloadOptions) flags(fs *flag.FlagSet) {
+	fs.BoolVar(&o.force, "force", false, "apply the config even if it removes many devices")
+}
+
+// runReloadCommand implements "ping_monitor reload [--force]" by calling the API of the running monitor
+// with the token in PINGGO_API_TOKEN
+func runReloadCommand(config *Config, args []string) error {
+	var options reloadOptions
+	fs := flag.NewFlagSet("reload", flag.ExitOnError)
+	options.flags(fs)
+	fs.Parse(args)
+
+	if config.API == nil || config.API.Listen == "" {
+		return fmt.Errorf("reload needs the API, or send SIGHUP to the monitor")
+	}
+	token := os.Getenv("PINGGO_API_TOKEN")
+	if token == "" {
+		return fmt.Errorf("PINGGO_API_TOKEN must hold a token with the write scope")
+	}
+	host := config.API.Listen
+	if strings.HasPrefix(host, ":") {
+		host = "localhost" + host
+	}
+
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://%s/api/reload?force=%t", host, options.force), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach the monitor: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("reload failed: %s", strings.TrimSpace(string(body)))
+	}
+	var diff ConfigDiff
+	if err := json.NewDecoder(resp.Body).Decode(&diff); err != nil {
+		return fmt.Errorf("could not decode response: %w", err)
+	}
+	if diff.Empty() {
+		fmt.Println("Device list reloaded, no changes")
+		return nil
+	}
+	fmt.Printf("Device list reloaded:\n%s", diff)
+	return nil
+}
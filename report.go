@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// reportRetention is how far back on-demand reports can look
+const reportRetention = 7 * 24 * time.Hour
+
+// uptimeTracker remembers the status transitions of every device for on-demand reports
+type uptimeTracker struct {
+	mu      sync.Mutex
+	devices map[string]*deviceTimeline // By IP
+}
+
+type deviceTimeline struct {
+	device      Device
+	transitions []statusTransition
+	notes       []DeviceNote
+}
+
+type statusTransition struct {
+	time      time.Time
+	state     DeviceState
+	reachable bool
+}
+
+// deviceUptime summarizes one device over a report window
+type deviceUptime struct {
+	Device   Device
+	State    DeviceState
+	Uptime   float64 // Percentage of the observed time the device was reachable, excluding quiet states
+	Downtime time.Duration
+	Notes    []DeviceNote // Written during the window
+}
+
+func newUptimeTracker() *uptimeTracker {
+	return &uptimeTracker{devices: make(map[string]*deviceTimeline)}
+}
+
+// Observe records the state a device had at the given time
+func (t *uptimeTracker) Observe(device Device, state DeviceState, reachable bool, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	timeline, ok := t.devices[device.IP]
+	if !ok {
+		timeline = &deviceTimeline{}
+		t.devices[device.IP] = timeline
+	}
+	timeline.device = device
+	if n := len(timeline.transitions); n == 0 || timeline.transitions[n-1].state != state || timeline.transitions[n-1].reachable != reachable {
+		timeline.transitions = append(timeline.transitions, statusTransition{time: at, state: state, reachable: reachable})
+	}
+
+	// Drop transitions that ended before the retention window, keeping the one still in effect
+	cutoff := at.Add(-reportRetention)
+	for len(timeline.transitions) > 1 && timeline.transitions[1].time.Before(cutoff) {
+		timeline.transitions = timeline.transitions[1:]
+	}
+	for len(timeline.notes) > 0 && timeline.notes[0].Time.Before(cutoff) {
+		timeline.notes = timeline.notes[1:]
+	}
+}
+
+// AddNote keeps a note for the reports of the device
+func (t *uptimeTracker) AddNote(note DeviceNote) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if timeline, ok := t.devices[note.IP]; ok {
+		timeline.notes = append(timeline.notes, note)
+	}
+}
+
+// Notes returns the notes written since a time, for one device or all of them if ip is empty
+func (t *uptimeTracker) Notes(ip string, since time.Time) []DeviceNote {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var notes []DeviceNote
+	for _, timeline := range t.devices {
+		if ip != "" && timeline.device.IP != ip {
+			continue
+		}
+		for _, note := range timeline.notes {
+			if !note.Time.Before(since) {
+				notes = append(notes, note)
+			}
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool { return notes[i].Time.Before(notes[j].Time) })
+	return notes
+}
+
+// Summary computes uptime and incidents over the last window for all devices, or only those in group
+func (t *uptimeTracker) Summary(window time.Duration, group string, now time.Time) []deviceUptime {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	from := now.Add(-window)
+	var summary []deviceUptime
+	for _, timeline := range t.devices {
+		if group != "" && timeline.device.Group != group {
+			continue
+		}
+
+		var observed, up time.Duration
+		entry := deviceUptime{Device: timeline.device}
+		for i, tr := range timeline.transitions {
+			start, end := tr.time, now
+			if i+1 < len(timeline.transitions) {
+				end = timeline.transitions[i+1].time
+			}
+			if start.Before(from) {
+				start = from
+			}
+			entry.State = tr.state
+			// Maintenance, mutes and expected downtime do not count against uptime
+			if !end.After(start) || tr.state.Quiet() {
+				continue
+			}
+
+			observed += end.Sub(start)
+			if tr.reachable {
+				up += end.Sub(start)
+			} else {
+				entry.Downtime += end.Sub(start)
+			}
+		}
+		if observed == 0 {
+			continue
+		}
+		for _, note := range timeline.notes {
+			if !note.Time.Before(from) {
+				entry.Notes = append(entry.Notes, note)
+			}
+		}
+		entry.Uptime = 100 * float64(up) / float64(observed)
+		summary = append(summary, entry)
+	}
+
+	// Worst devices first
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Uptime != summary[j].Uptime {
+			return summary[i].Uptime < summary[j].Uptime
+		}
+		return summary[i].Device.Description < summary[j].Device.Description
+	})
+	return summary
+}
+
+// reportQuery is what a /report command asks for
+type reportQuery struct {
+	Window time.Duration
+	Group  string
+	Chart  bool // Also send the uptime as an image
+}
+
+// reportUsage is the reply to a /report command with arguments it does not understand
+const reportUsage = "Usage: /report [24h|7d] [group] [chart]"
+
+// parseReportArgs reads the optional window ("24h", "7d"), group name and "chart" of a /report command.
+// groups holds the known group names; anything else is rejected rather than reported as an empty group.
+func parseReportArgs(args []string, groups map[string]bool) (reportQuery, error) {
+	query := reportQuery{Window: 24 * time.Hour}
+	for _, arg := range args {
+		if d, err := parseWindow(arg); err == nil {
+			query.Window = d
+		} else if groups[arg] && query.Group == "" {
+			query.Group = arg
+		} else if arg == "chart" && !query.Chart {
+			query.Chart = true
+		} else {
+			return reportQuery{}, fmt.Errorf("%s", reportUsage)
+		}
+	}
+	if query.Window > reportRetention {
+		return reportQuery{}, fmt.Errorf("reports can cover at most %s", formatWindow(reportRetention))
+	}
+	return query, nil
+}
+
+// reportGroups returns the names of the configured groups and of the groups devices are in
+func (m *monitor) reportGroups() map[string]bool {
+	groups := make(map[string]bool)
+	for name := range m.config.Groups {
+		groups[name] = true
+	}
+	for _, device := range m.Devices() {
+		if device.Group != "" {
+			groups[device.Group] = true
+		}
+	}
+	return groups
+}
+
+// reportChart renders the uptime chart asked for by a /report command, or returns nil if none was
+func (m *monitor) reportChart(text string) ([]byte, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || strings.SplitN(fields[0], "@", 2)[0] != "/report" {
+		return nil, nil
+	}
+	query, err := parseReportArgs(fields[1:], m.reportGroups())
+	if err != nil || !query.Chart {
+		return nil, nil
+	}
+	return renderUptimeChart(m.uptime.Summary(query.Window, query.Group, time.Now()), query.Window, query.Group)
+}
+
+// parseWindow accepts time.ParseDuration values plus whole days such as "7d"
+func parseWindow(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || days <= 0 {
+			return 0, fmt.Errorf("invalid window %q", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window %q", s)
+	}
+	return d, nil
+}
+
+func formatWindow(d time.Duration) string {
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+// formatReport renders an uptime summary and the incidents of the window as a chat message
+func formatReport(summary []deviceUptime, incidents []Incident, devices []Device, window time.Duration, group string) string {
+	var b strings.Builder
+	title := "📊 Uptime report, last " + formatWindow(window)
+	if group != "" {
+		title += ", group " + group
+	}
+	b.WriteString(title + "\n\n")
+
+	if len(summary) == 0 {
+		b.WriteString("No data for this period yet.")
+		return b.String()
+	}
+
+	// Incidents come from the incident tracker, so a device bouncing between down and flapping is one incident
+	perDevice := make(map[string]int)
+	for _, incident := range incidents {
+		for _, ip := range incident.Devices {
+			perDevice[ip]++
+		}
+	}
+	var total float64
+	for _, entry := range summary {
+		b.WriteString(fmt.Sprintf("%s %s: %.2f%%", entry.State.Emoji(), entry.Device.Description, entry.Uptime))
+		if count := perDevice[entry.Device.IP]; count > 0 {
+			b.WriteString(fmt.Sprintf(" (%d incidents, %s down)", count, entry.Downtime.Round(time.Second)))
+		} else if entry.Downtime > 0 {
+			b.WriteString(fmt.Sprintf(" (%s down)", entry.Downtime.Round(time.Second)))
+		}
+		b.WriteString("\n")
+		for _, note := range entry.Notes {
+			b.WriteString(fmt.Sprintf("   📝 %s %s (%s)\n", note.Time.Format("Jan 2 15:04"), note.Text, note.Author))
+		}
+		total += entry.Uptime
+	}
+	b.WriteString(fmt.Sprintf("\nAverage uptime: %.2f%%, incidents: %d", total/float64(len(summary)), len(incidents)))
+	if len(incidents) > 0 {
+		b.WriteString("\n\nIncident timeline:\n")
+		b.WriteString(formatIncidents(incidents, devices, time.Now()))
+	}
+	return b.String()
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// maxChartDevices limits the chart to the devices with the lowest uptime, which the summary lists first
+const maxChartDevices = 25
+
+// renderUptimeChart draws the uptime of each device as a horizontal bar, red below 99% and orange below 99.9%
+func renderUptimeChart(summary []deviceUptime, window time.Duration, group string) ([]byte, error) {
+	if len(summary) > maxChartDevices {
+		summary = summary[:maxChartDevices]
+	}
+	const (
+		width     = 640
+		rowHeight = 22
+		labelW    = 200
+		barW      = 360
+		top       = 36
+	)
+	height := top + rowHeight*len(summary) + 10
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	text := func(x, y int, s string) {
+		d := font.Drawer{Dst: img, Src: image.Black, Face: basicfont.Face7x13, Dot: fixed.P(x, y)}
+		d.DrawString(s)
+	}
+	title := "Uptime, last " + formatWindow(window)
+	if group != "" {
+		title += ", group " + group
+	}
+	text(10, 22, title)
+
+	for i, entry := range summary {
+		y := top + i*rowHeight
+		label := entry.Device.Description
+		if runes := []rune(label); len(runes) > 27 {
+			label = string(runes[:24]) + "..." // The basic font has no ellipsis glyph
+		}
+		text(10, y+15, label)
+
+		bar := color.RGBA{0x2e, 0xa0, 0x43, 0xff} // Green
+		switch {
+		case entry.Uptime < 99:
+			bar = color.RGBA{0xd7, 0x3a, 0x49, 0xff}
+		case entry.Uptime < 99.9:
+			bar = color.RGBA{0xe3, 0x8b, 0x1c, 0xff}
+		}
+		length := int(entry.Uptime / 100 * barW)
+		draw.Draw(img, image.Rect(labelW, y+3, labelW+barW, y+rowHeight-3), image.NewUniform(color.RGBA{0xee, 0xee, 0xee, 0xff}), image.Point{}, draw.Src)
+		draw.Draw(img, image.Rect(labelW, y+3, labelW+length, y+rowHeight-3), image.NewUniform(bar), image.Point{}, draw.Src)
+		text(labelW+barW+8, y+15, fmt.Sprintf("%.2f%%", entry.Uptime))
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("could not encode chart: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// sendTelegramPhoto uploads a PNG image to the chat
+func sendTelegramPhoto(botToken, chatID, caption string, image []byte) error {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("chat_id", chatID)
+	form.WriteField("caption", caption)
+	part, err := form.CreateFormFile("photo", "report.png")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, bytes.NewReader(image)); err != nil {
+		return err
+	}
+	if err := form.Close(); err != nil {
+		return err
+	}
+
+	start := time.Now()
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(fmt.Sprintf("https://api.telegram.org/bot%s/sendPhoto", botToken), form.FormDataContentType(), &body)
+	recordTelegramLatency(time.Since(start))
+	if err != nil {
+		return fmt.Errorf("could not send photo to Telegram: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
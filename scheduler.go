@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProbeBudget caps how many probes the monitor sends, for links where the monitoring traffic matters.
+// When the due devices need more, the most important ones are checked first and the others wait,
+// which stretches their interval instead of overrunning the cycle.
+type ProbeBudget struct {
+	ProbesPerSecond float64 `yaml:"probes_per_second"` // Pings or TCP connection attempts per second
+	BytesPerMinute  int     `yaml:"bytes_per_minute"`  // Probe traffic in both directions, headers included
+}
+
+// Estimated traffic of a single probe, request and answer
+const (
+	icmpProbeBytes = 2 * (20 + 8 + 24) // IPv4 and ICMP headers with the default payload of 24 bytes
+	tcpProbeBytes  = 4 * 60            // SYN, SYN-ACK, ACK and the closing packet
+)
+
+// probeCost is the number of probes a check of the device sends
+func probeCost(device Device) int {
+	if device.Probe == "synthetic" {
+		return 0
+	}
+	if device.Count > 0 {
+		return device.Count
+	}
+	return defaultCount
+}
+
+// probeBytes is the estimated traffic of a check of the device
+func probeBytes(device Device) int {
+	if strings.HasPrefix(device.Probe, "tcp:") {
+		return probeCost(device) * tcpProbeBytes
+	}
+	return probeCost(device) * icmpProbeBytes
+}
+
+// limited reports whether the budget restricts anything
+func (b *ProbeBudget) limited() bool {
+	return b != nil && (b.ProbesPerSecond > 0 || b.BytesPerMinute > 0)
+}
+
+// severityRank is the scheduling priority of a device: 1 for info, 2 for warning, 3 for critical
+func severityRank(device Device) float64 {
+	if rank, ok := severities[device.Severity]; ok {
+		return float64(rank)
+	}
+	return float64(severities["warning"])
+}
+
+// scheduleChecks returns the IPs of the devices to probe this cycle. Without a budget these are all devices
+// that are due. With one, the due devices are ranked by severity plus the number of intervals they are
+// overdue, so a critical device goes first but an info device that waited two intervals is not starved,
+// and are taken while the probes fit in what the budget allows until the next cycle.
+func (m *monitor) scheduleChecks(devices []Device, now time.Time, budget *ProbeBudget, probes *cycleProbes) map[string]bool {
+	var candidates []Device
+	score := make(map[string]float64)
+	for _, device := range devices {
+		next := m.nextCheck[device.IP]
+		if _, checked := m.results[device.IP]; checked && now.Before(next) {
+			continue
+		}
+		candidates = append(candidates, device)
+		if !next.IsZero() {
+			score[device.IP] = severityRank(device) + float64(now.Sub(next))/float64(deviceInterval(device))
+		} else {
+			// Never checked yet: go first so every device gets a result
+			score[device.IP] = 1000
+		}
+	}
+
+	due := make(map[string]bool, len(candidates))
+	if !budget.limited() {
+		for _, device := range candidates {
+			due[device.IP] = true
+		}
+		return due
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool { return score[candidates[i].IP] > score[candidates[j].IP] })
+	window := cycleInterval(devices).Seconds()
+	var packets, bytes float64
+	deferred := 0
+	charged := make(map[string]bool) // Devices sharing a target are probed once
+	for _, device := range candidates {
+		p, b := float64(probeCost(device)), float64(probeBytes(device))
+		key := probes.key(device)
+		if charged[key] {
+			p, b = 0, 0
+		}
+		over := budget.ProbesPerSecond > 0 && packets+p > budget.ProbesPerSecond*window ||
+			budget.BytesPerMinute > 0 && bytes+b > float64(budget.BytesPerMinute)/60*window
+		// At least one device is checked per cycle, even if it alone exceeds the budget
+		if len(due) > 0 && over {
+			deferred++
+			continue
+		}
+		due[device.IP] = true
+		charged[key] = true
+		packets += p
+		bytes += b
+	}
+	if deferred > 0 {
+		fmt.Printf("Probe budget: %d of %d due devices deferred to the next cycle\n", deferred, len(candidates))
+		if m.pacer != nil {
+			m.pacer.Defer(deferred)
+		}
+	}
+	return due
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestScheduleChecks(t *testing.T) {
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	interval := Duration(10 * time.Second)
+	device := func(ip, severity string) Device {
+		return Device{Description: ip, IP: ip, Severity: severity, Interval: interval, Count: 3}
+	}
+	critical, warning, info := device("10.0.0.1", "critical"), device("10.0.0.2", "warning"), device("10.0.0.3", "info")
+	synthetic := Device{Description: "synthetic", IP: "synthetic:test", Probe: "synthetic", Interval: interval}
+
+	// checked marks devices as checked before, due again at the given offset from now
+	type checked map[string]time.Duration
+
+	tests := []struct {
+		name    string
+		devices []Device
+		checked checked
+		budget  *ProbeBudget
+		want    []string
+	}{
+		{
+			name:    "no budget checks every due device",
+			devices: []Device{critical, warning, info},
+			checked: checked{"10.0.0.1": 0, "10.0.0.2": -time.Second},
+			want:    []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		},
+		{
+			name:    "devices not due yet are skipped",
+			devices: []Device{critical, warning, info},
+			checked: checked{"10.0.0.1": 5 * time.Second, "10.0.0.2": 0, "10.0.0.3": 5 * time.Second},
+			want:    []string{"10.0.0.2"},
+		},
+		{
+			// 0.6 probes per second over the 10s cycle fit two devices of 3 probes
+			name:    "budget keeps the most severe devices",
+			devices: []Device{info, warning, critical, device("10.0.0.4", "info")},
+			checked: checked{"10.0.0.1": 0, "10.0.0.2": 0, "10.0.0.3": 0, "10.0.0.4": 0},
+			budget:  &ProbeBudget{ProbesPerSecond: 0.6},
+			want:    []string{"10.0.0.1", "10.0.0.2"},
+		},
+		{
+			name:    "devices never checked go first",
+			devices: []Device{critical, info},
+			checked: checked{"10.0.0.1": 0},
+			budget:  &ProbeBudget{ProbesPerSecond: 0.3},
+			want:    []string{"10.0.0.3"},
+		},
+		{
+			// Three intervals overdue: 1 + 3 outranks a critical device that just became due
+			name:    "an overdue device is not starved",
+			devices: []Device{critical, info},
+			checked: checked{"10.0.0.1": 0, "10.0.0.3": -30 * time.Second},
+			budget:  &ProbeBudget{ProbesPerSecond: 0.3},
+			want:    []string{"10.0.0.3"},
+		},
+		{
+			name:    "one device is checked even if it alone exceeds the budget",
+			devices: []Device{critical, warning},
+			checked: checked{"10.0.0.1": 0, "10.0.0.2": 0},
+			budget:  &ProbeBudget{ProbesPerSecond: 0.01},
+			want:    []string{"10.0.0.1"},
+		},
+		{
+			// 3 probes of 104 bytes per check, 1872 bytes per minute allow 312 bytes in a 10s cycle
+			name:    "bytes per minute",
+			devices: []Device{critical, warning},
+			checked: checked{"10.0.0.1": 0, "10.0.0.2": 0},
+			budget:  &ProbeBudget{BytesPerMinute: 1872},
+			want:    []string{"10.0.0.1"},
+		},
+		{
+			name:    "synthetic devices cost nothing",
+			devices: []Device{critical, synthetic},
+			checked: checked{"10.0.0.1": 0, "synthetic:test": 0},
+			budget:  &ProbeBudget{ProbesPerSecond: 0.3},
+			want:    []string{"10.0.0.1", "synthetic:test"},
+		},
+	}
+	for _, tt := range tests {
+		m := &monitor{nextCheck: make(map[string]time.Time), results: make(map[string]DeviceResult)}
+		for ip, offset := range tt.checked {
+			m.nextCheck[ip] = now.Add(offset)
+			m.results[ip] = DeviceResult{IP: ip, State: StateUp}
+		}
+		due := m.scheduleChecks(tt.devices, now, tt.budget, newCycleProbes())
+		var got []string
+		for ip := range due {
+			got = append(got, ip)
+		}
+		sort.Strings(got)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: due = %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: due = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
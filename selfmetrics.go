@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SelfMonitoringConfig alerts on a secondary channel when notifications keep failing
+type SelfMonitoringConfig struct {
+	FailureRate float64  `yaml:"failure_rate"` // Percentage of failed deliveries on a channel that triggers the alert, default 50
+	Window      Duration `yaml:"window"`       // Period the rate is computed over, default 1h
+	MinAttempts int      `yaml:"min_attempts"` // Deliveries needed in the window before alerting, default 3
+	Channel     string   `yaml:"channel"`      // "telegram" or the name of a webhook or chat
+}
+
+// selfStats collects metrics about the monitor itself. Notifications are sent from several goroutines
+// and free functions, so it is shared by the whole process.
+var selfStats = &selfMetrics{channels: make(map[string]*channelStats)}
+
+type selfMetrics struct {
+	mu              sync.Mutex
+	channels        map[string]*channelStats
+	telegramLatency time.Duration // Sum over all Telegram API calls
+	telegramCalls   int
+	cycleDuration   time.Duration // Of the last completed cycle
+	window          time.Duration // Deliveries kept for self-monitoring, 0 keeps none
+}
+
+type channelStats struct {
+	successes int
+	failures  int
+	recent    []delivery // Within the self-monitoring window
+	alerted   bool
+}
+
+type delivery struct {
+	time   time.Time
+	failed bool
+}
+
+// recordDelivery counts a notification sent to a channel and passes the error on
+func recordDelivery(channel string, err error) error {
+	selfStats.mu.Lock()
+	defer selfStats.mu.Unlock()
+
+	stats, ok := selfStats.channels[channel]
+	if !ok {
+		stats = &channelStats{}
+		selfStats.channels[channel] = stats
+	}
+	if err != nil {
+		stats.failures++
+	} else {
+		stats.successes++
+	}
+	if selfStats.window > 0 {
+		now := time.Now()
+		stats.recent = append(pruneDeliveries(stats.recent, now.Add(-selfStats.window)), delivery{time: now, failed: err != nil})
+	}
+	return err
+}
+
+// trackDeliveries keeps the deliveries of the last window for failingChannels. Without self-monitoring
+// nothing is kept, so the history cannot grow for the life of the process.
+func trackDeliveries(window time.Duration) {
+	selfStats.mu.Lock()
+	defer selfStats.mu.Unlock()
+	selfStats.window = window
+}
+
+// pruneDeliveries drops the deliveries before cutoff
+func pruneDeliveries(recent []delivery, cutoff time.Time) []delivery {
+	for len(recent) > 0 && recent[0].time.Before(cutoff) {
+		recent = recent[1:]
+	}
+	return recent
+}
+
+// window returns the period failure rates are computed over
+func (c *SelfMonitoringConfig) window() time.Duration {
+	if c.Window <= 0 {
+		return time.Hour
+	}
+	return c.Window.Duration()
+}
+
+// recordTelegramLatency adds the duration of one Telegram API call
+func recordTelegramLatency(d time.Duration) {
+	selfStats.mu.Lock()
+	defer selfStats.mu.Unlock()
+	selfStats.telegramLatency += d
+	selfStats.telegramCalls++
+}
+
+// recordCycle remembers how long the last check cycle took
+func recordCycle(d time.Duration) {
+	selfStats.mu.Lock()
+	defer selfStats.mu.Unlock()
+	selfStats.cycleDuration = d
+}
+
+// failingChannels returns the channels whose failure rate crossed the threshold since the last check,
+// with their rates. Channels are reported once until their rate drops below the threshold again.
+func failingChannels(config *SelfMonitoringConfig, now time.Time) map[string]float64 {
+	threshold := config.FailureRate
+	if threshold <= 0 {
+		threshold = 50
+	}
+	minAttempts := config.MinAttempts
+	if minAttempts <= 0 {
+		minAttempts = 3
+	}
+
+	selfStats.mu.Lock()
+	defer selfStats.mu.Unlock()
+
+	failing := make(map[string]float64)
+	for name, stats := range selfStats.channels {
+		stats.recent = pruneDeliveries(stats.recent, now.Add(-config.window()))
+		failed := 0
+		for _, d := range stats.recent {
+			if d.failed {
+				failed++
+			}
+		}
+		rate := 0.0
+		if len(stats.recent) > 0 {
+			rate = 100 * float64(failed) / float64(len(stats.recent))
+		}
+
+		if len(stats.recent) >= minAttempts && rate >= threshold {
+			if !stats.alerted {
+				failing[name] = rate
+			}
+			stats.alerted = true
+		} else if rate < threshold {
+			stats.alerted = false
+		}
+	}
+	return failing
+}
+
+// checkDelivery alerts on the self-monitoring channel about channels that keep failing
+func (m *monitor) checkDelivery(now time.Time) {
+	config := m.config.SelfMonitoring
+	if config == nil {
+		return
+	}
+	for channel, rate := range failingChannels(config, now) {
+		if channel == config.Channel {
+			fmt.Printf("Warning: %.0f%% of notifications to the self-monitoring channel %s failed\n", rate, channel)
+			continue
+		}
+		message := fmt.Sprintf("⚠️ %.0f%% of notifications to %s failed recently, alerts may not be reaching anyone", rate, channel)
+		payload := map[string]interface{}{"channel": channel, "failure_rate": rate, "time": now}
+		if err := m.notifyChannel(config.Channel, message, payload); err != nil {
+			fmt.Printf("Error sending self-monitoring alert: %v\n", err)
+		}
+	}
+}
+
+// writeSelfMetrics appends the metrics about the monitor itself in the Prometheus text format
+func writeSelfMetrics(b *strings.Builder, queueDepth int) {
+	selfStats.mu.Lock()
+	defer selfStats.mu.Unlock()
+
+	info := buildInfo()
+	b.WriteString("# HELP pinggo_build_info Version of the running monitor, always 1.\n")
+	b.WriteString("# TYPE pinggo_build_info gauge\n")
+	fmt.Fprintf(b, "pinggo_build_info{version=%q,commit=%q,go_version=%q} 1\n", info.Version, info.Commit, info.GoVersion)
+
+	names := make([]string, 0, len(selfStats.channels))
+	for name := range selfStats.channels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b.WriteString("# HELP pinggo_notifications_total Notifications sent per channel and result.\n")
+	b.WriteString("# TYPE pinggo_notifications_total counter\n")
+	for _, name := range names {
+		stats := selfStats.channels[name]
+		fmt.Fprintf(b, "pinggo_notifications_total{channel=%q,result=\"success\"} %d\n", name, stats.successes)
+		fmt.Fprintf(b, "pinggo_notifications_total{channel=%q,result=\"failure\"} %d\n", name, stats.failures)
+	}
+
+	b.WriteString("# HELP pinggo_telegram_api_latency_seconds Duration of Telegram API calls.\n")
+	b.WriteString("# TYPE pinggo_telegram_api_latency_seconds summary\n")
+	fmt.Fprintf(b, "pinggo_telegram_api_latency_seconds_sum %g\n", selfStats.telegramLatency.Seconds())
+	fmt.Fprintf(b, "pinggo_telegram_api_latency_seconds_count %d\n", selfStats.telegramCalls)
+
+	b.WriteString("# HELP pinggo_cycle_duration_seconds Duration of the last check cycle.\n")
+	b.WriteString("# TYPE pinggo_cycle_duration_seconds gauge\n")
+	fmt.Fprintf(b, "pinggo_cycle_duration_seconds %g\n", selfStats.cycleDuration.Seconds())
+
+	b.WriteString("# HELP pinggo_digest_queue_depth Events waiting for the next digest.\n")
+	b.WriteString("# TYPE pinggo_digest_queue_depth gauge\n")
+	fmt.Fprintf(b, "pinggo_digest_queue_depth %d\n", queueDepth)
+}
@@ -0,0 +1,91 @@
+package main
+
+import "fmt"
+
+// Device severities from least to most important. Devices without a severity are "warning".
+var severities = map[string]int{"info": 1, "warning": 2, "critical": 3}
+
+// validSeverity reports whether s is empty or a known severity
+func validSeverity(s string) bool {
+	_, ok := severities[s]
+	return ok || s == ""
+}
+
+// meetsSeverity reports whether a device is at least as important as min; an empty min lets everything through
+func meetsSeverity(device Device, min string) bool {
+	if min == "" {
+		return true
+	}
+	severity := device.Severity
+	if severity == "" {
+		severity = "warning"
+	}
+	return severities[severity] >= severities[min]
+}
+
+// filterSeverity returns the changes of devices at least as important as min
+func filterSeverity(changes []StatusChange, devices []Device, min string) []StatusChange {
+	if min == "" {
+		return changes
+	}
+	var filtered []StatusChange
+	for _, change := range changes {
+		// Devices that are no longer configured are let through rather than silently dropped
+		if device, ok := findDevice(devices, change.IP); !ok || meetsSeverity(device, min) {
+			filtered = append(filtered, change)
+		}
+	}
+	return filtered
+}
+
+// filterResultsSeverity keeps the results of devices at least as severe as min
+func filterResultsSeverity(results []DeviceResult, devices []Device, min string) []DeviceResult {
+	if min == "" {
+		return results
+	}
+	var filtered []DeviceResult
+	for _, result := range results {
+		if device, ok := findDevice(devices, result.IP); !ok || meetsSeverity(device, min) {
+			filtered = append(filtered, result)
+		}
+	}
+	return filtered
+}
+
+// channelAccepts reports whether a named channel wants alerts about the device
+func (c *Config) channelAccepts(name string, device Device) bool {
+	if name == "telegram" {
+		return meetsSeverity(device, c.TelegramMinSeverity)
+	}
+	for _, webhook := range c.Webhooks {
+		if webhook.Name == name {
+			return meetsSeverity(device, webhook.MinSeverity)
+		}
+	}
+	for _, chat := range c.Chats {
+		if chat.Name == name {
+			return meetsSeverity(device, chat.MinSeverity)
+		}
+	}
+	return true
+}
+
+// validateSeverities checks the min_severity of every channel
+func (c *Config) validateSeverities() error {
+	channels := map[string]string{
+		"telegram":      c.TelegramMinSeverity,
+		"public_status": c.PublicStatus.MinSeverity,
+	}
+	if c.Digest != nil {
+		channels["digest"] = c.Digest.MinSeverity
+	}
+	for _, webhook := range c.Webhooks {
+		channels["webhook "+webhook.URL] = webhook.MinSeverity
+	}
+	for channel, min := range channels {
+		if !validSeverity(min) {
+			return fmt.Errorf("%s: unknown min_severity %q", channel, min)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// shard selects a deterministic subset of the devices, e.g. shard 2 of 5
+type shard struct {
+	index int // 1-based
+	total int
+}
+
+// parseShard parses "N/M" as given to --shard
+func parseShard(s string) (shard, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) != 2 {
+		return shard{}, fmt.Errorf("invalid shard %q, expected N/M", s)
+	}
+	index, err1 := strconv.Atoi(parts[0])
+	total, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || total < 1 || index < 1 || index > total {
+		return shard{}, fmt.Errorf("invalid shard %q, expected N/M with 1 <= N <= M", s)
+	}
+	return shard{index: index, total: total}, nil
+}
+
+func (s shard) String() string {
+	return fmt.Sprintf("%d/%d", s.index, s.total)
+}
+
+// Devices returns the devices belonging to this shard. The split depends only on the device IPs,
+// so every instance agrees on it without coordination.
+func (s shard) Devices(devices []Device) []Device {
+	var selected []Device
+	for _, device := range devices {
+		if int(hashKey(device.IP)%uint32(s.total)) == s.index-1 {
+			selected = append(selected, device)
+		}
+	}
+	return selected
+}
+
+// overlaps reports whether some device belongs to both shards. A device is in shard a/M when its hash h
+// has h mod M = a-1, so a/M and b/N share devices exactly when a-1 and b-1 are equal modulo gcd(M, N):
+// 2/5 and 1/3 overlap, 1/2 and 2/4 do not.
+func (s shard) overlaps(other shard) bool {
+	a, b := s.total, other.total
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return (s.index-1)%a == (other.index-1)%a
+}
+
+// heartbeat keeps this replica in the member list and refreshes its shard claim. It runs on its own ticker
+// because a check cycle can take longer than memberTTL, e.g. with long device intervals or many hosts timing out.
+func (m *monitor) heartbeat() {
+	warned := make(map[string]string) // Instance -> shard already warned about
+	for {
+		if err := m.state.Heartbeat(); err != nil {
+			fmt.Printf("Error refreshing replica membership: %v\n", err)
+		}
+		if m.shard != nil {
+			m.checkShardOverlap(warned)
+		}
+		time.Sleep(heartbeatInterval)
+	}
+}
+
+// checkShardOverlap claims this instance's shard and warns about live replicas whose shard shares devices
+// with it, including shards of a different count such as 2/5 and 1/3
+func (m *monitor) checkShardOverlap(warned map[string]string) {
+	if err := m.state.ClaimShard(m.shard.String()); err != nil {
+		fmt.Printf("Error claiming shard %s: %v\n", m.shard, err)
+		return
+	}
+	claims, err := m.state.ShardClaims()
+	if err != nil {
+		fmt.Printf("Error checking shard overlap: %v\n", err)
+		return
+	}
+	for instance, claim := range claims {
+		other, err := parseShard(claim)
+		if instance == m.config.Instance || err != nil || !m.shard.overlaps(other) {
+			delete(warned, instance)
+			continue
+		}
+		if warned[instance] != claim {
+			fmt.Printf("Warning: shard %s overlaps shard %s of instance %s, their common devices are monitored twice\n", m.shard, claim, instance)
+			warned[instance] = claim
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func testDevices(n int) []Device {
+	devices := make([]Device, n)
+	for i := range devices {
+		devices[i] = Device{Description: fmt.Sprintf("host-%d", i), IP: fmt.Sprintf("10.0.%d.%d", i/250, i%250+1)}
+	}
+	return devices
+}
+
+func TestParseShard(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    shard
+		wantErr bool
+	}{
+		{in: "1/1", want: shard{index: 1, total: 1}},
+		{in: "2/5", want: shard{index: 2, total: 5}},
+		{in: "5/5", want: shard{index: 5, total: 5}},
+		{in: "0/5", wantErr: true},
+		{in: "6/5", wantErr: true},
+		{in: "1/0", wantErr: true},
+		{in: "1", wantErr: true},
+		{in: "1/2/3", wantErr: true},
+		{in: "a/b", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseShard(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseShard(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && got != tt.want {
+			t.Errorf("parseShard(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestShardDevicesPartition(t *testing.T) {
+	devices := testDevices(500)
+	for _, total := range []int{1, 2, 3, 5, 8} {
+		seen := make(map[string]int)
+		for index := 1; index <= total; index++ {
+			for _, device := range (shard{index: index, total: total}).Devices(devices) {
+				seen[device.IP]++
+			}
+		}
+		for _, device := range devices {
+			if seen[device.IP] != 1 {
+				t.Errorf("%d shards: %s is in %d shards, want exactly 1", total, device.IP, seen[device.IP])
+			}
+		}
+	}
+}
+
+func TestShardOverlaps(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"1/2", "1/2", true},
+		{"1/2", "2/2", false},
+		{"1/2", "2/4", false},
+		{"1/2", "3/4", true},
+		{"2/5", "1/3", true},
+		{"1/4", "2/6", false},
+		{"1/4", "3/6", true},
+		{"1/1", "3/7", true},
+	}
+	for _, tt := range tests {
+		a, _ := parseShard(tt.a)
+		b, _ := parseShard(tt.b)
+		if got := a.overlaps(b); got != tt.want {
+			t.Errorf("%s overlaps %s = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.overlaps(a); got != tt.want {
+			t.Errorf("%s overlaps %s = %v, want %v", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+// The overlap rule must agree with the devices the shards actually select
+func TestShardOverlapsMatchesDevices(t *testing.T) {
+	devices := testDevices(2000)
+	for m := 1; m <= 6; m++ {
+		for n := 1; n <= 6; n++ {
+			for i := 1; i <= m; i++ {
+				for j := 1; j <= n; j++ {
+					a, b := shard{index: i, total: m}, shard{index: j, total: n}
+					inA := make(map[string]bool)
+					for _, device := range a.Devices(devices) {
+						inA[device.IP] = true
+					}
+					shared := false
+					for _, device := range b.Devices(devices) {
+						shared = shared || inA[device.IP]
+					}
+					if shared != a.overlaps(b) {
+						t.Errorf("%s and %s share devices = %v, overlaps = %v", a, b, shared, a.overlaps(b))
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOwnedDevices(t *testing.T) {
+	devices := testDevices(1000)
+
+	if got := ownedDevices(devices, []string{"a"}, "a"); len(got) != len(devices) {
+		t.Errorf("single member owns %d devices, want all %d", len(got), len(devices))
+	}
+
+	members := []string{"a", "b", "c"}
+	owner := make(map[string]string)
+	for _, member := range members {
+		owned := ownedDevices(devices, members, member)
+		if len(owned) < len(devices)/10 {
+			t.Errorf("member %s owns only %d of %d devices", member, len(owned), len(devices))
+		}
+		for _, device := range owned {
+			if previous, ok := owner[device.IP]; ok {
+				t.Errorf("%s is owned by both %s and %s", device.IP, previous, member)
+			}
+			owner[device.IP] = member
+		}
+	}
+	if len(owner) != len(devices) {
+		t.Errorf("%d of %d devices have an owner", len(owner), len(devices))
+	}
+
+	// A joining member only takes devices over, the others keep theirs
+	joined := append(members, "d")
+	for _, member := range members {
+		for _, device := range ownedDevices(devices, joined, member) {
+			if owner[device.IP] != member {
+				t.Errorf("%s moved from %s to %s when d joined", device.IP, owner[device.IP], member)
+			}
+		}
+	}
+}
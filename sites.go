@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+)
+
+// Location is a point on the dashboard map
+type Location struct {
+	Lat float64 `yaml:"lat" json:"lat"`
+	Lon float64 `yaml:"lon" json:"lon"`
+}
+
+// SiteStatus is a location on the dashboard map with the devices there, colored by the worst of their states
+type SiteStatus struct {
+	Name     string         `json:"name"`
+	Location Location       `json:"location"`
+	State    DeviceState    `json:"state"`
+	Devices  []DeviceResult `json:"devices"`
+}
+
+// stateRank orders the states from harmless to worst; quiet states rank below up so they do not hide
+// a healthy site, but a site where every device is in maintenance still shows as such
+var stateRank = map[DeviceState]int{
+	StateMaintenance:  0,
+	StateMuted:        0,
+	StateExpectedDown: 0,
+	StateUp:           1,
+	StateUnknown:      2,
+	StateDegraded:     3,
+	StateFlapping:     4,
+	StateDown:         5,
+}
+
+// siteStatus groups the results of a cycle by site. Devices with their own location are a site of their
+// own, devices without a site or location are left out.
+func siteStatus(devices []Device, sites map[string]Location, results []DeviceResult) []SiteStatus {
+	byIP := make(map[string]DeviceResult, len(results))
+	for _, result := range results {
+		byIP[result.IP] = result
+	}
+
+	index := make(map[string]int)
+	status := []SiteStatus{}
+	for _, device := range devices {
+		name, location := device.Site, sites[device.Site]
+		if device.Location != nil {
+			name, location = device.Description, *device.Location
+		} else if name == "" {
+			continue
+		}
+
+		result, ok := byIP[device.IP]
+		if !ok {
+			result = DeviceResult{Description: device.Description, IP: device.IP, State: StateUnknown}
+		}
+		i, ok := index[name]
+		if !ok {
+			i = len(status)
+			index[name] = i
+			status = append(status, SiteStatus{Name: name, Location: location, State: result.State})
+		}
+		if stateRank[result.State] > stateRank[status[i].State] {
+			status[i].State = result.State
+		}
+		status[i].Devices = append(status[i].Devices, result)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+	return status
+}
+
+// handleSites returns the sites with the worst state of their devices in the last completed cycle
+func (m *monitor) handleSites(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	m.mu.Lock()
+	snapshot := m.lastSnapshot
+	m.mu.Unlock()
+	writeJSON(w, siteStatus(m.Devices(), m.config.Sites, snapshot.Results))
+}
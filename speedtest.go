@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// SpeedtestConfig schedules a bandwidth measurement, either an HTTP download or an iperf3 run
+type SpeedtestConfig struct {
+	Method   string   `yaml:"method"`   // "http" (default) or "iperf3"
+	URL      string   `yaml:"url"`      // File downloaded by the http method
+	Server   string   `yaml:"server"`   // iperf3 server, "host" or "host:port"
+	Interval Duration `yaml:"interval"` // Default 1h
+	Duration Duration `yaml:"duration"` // Length of the test, default 10s
+	MinMbps  float64  `yaml:"min_mbps"` // Alert when the measured download rate falls below this
+}
+
+// ThroughputResult is one bandwidth measurement
+type ThroughputResult struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Target string    `json:"target"` // URL or iperf3 server
+	Mbps   float64   `json:"mbps"`   // Download rate in Mbit/s
+}
+
+// throughputStore is implemented by history stores that keep speed test results
+type throughputStore interface {
+	RecordThroughput(result ThroughputResult) error
+}
+
+// validate checks that the chosen method has a target
+func (c *SpeedtestConfig) validate() error {
+	switch c.Method {
+	case "", "http":
+		if c.URL == "" {
+			return fmt.Errorf("speedtest url is required for the http method")
+		}
+	case "iperf3":
+		if c.Server == "" {
+			return fmt.Errorf("speedtest server is required for the iperf3 method")
+		}
+	default:
+		return fmt.Errorf("unknown speed test method %q", c.Method)
+	}
+	return nil
+}
+
+// runSpeedtests measures the throughput every interval, records it and alerts when it crosses min_mbps
+func (m *monitor) runSpeedtests() {
+	config := m.config.Speedtest
+	interval := config.Interval.Duration()
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	slow := false
+
+	for {
+		result, err := measureThroughput(config)
+		if err != nil {
+			fmt.Printf("Speed test failed: %v\n", err)
+		} else {
+			fmt.Printf("Speed test: %.1f Mbit/s from %s\n", result.Mbps, result.Target)
+			for _, store := range m.stores {
+				if recorder, ok := store.(throughputStore); ok {
+					if err := recorder.RecordThroughput(result); err != nil {
+						fmt.Printf("Error recording speed test: %v\n", err)
+					}
+				}
+			}
+
+			var message string
+			if config.MinMbps > 0 && result.Mbps < config.MinMbps && !slow {
+				message = fmt.Sprintf("🐢 Throughput is %.1f Mbit/s, below %.1f Mbit/s (%s)", result.Mbps, config.MinMbps, result.Target)
+				slow = true
+			} else if slow && result.Mbps >= config.MinMbps {
+				message = fmt.Sprintf("🚀 Throughput is back to %.1f Mbit/s (%s)", result.Mbps, result.Target)
+				slow = false
+			}
+			if message != "" && m.config.UseTelegram {
+				if err := recordDelivery("telegram", sendTelegramMessage(m.botToken, m.chatID, message)); err != nil {
+					fmt.Printf("Error sending Telegram message: %v\n", err)
+				}
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// measureThroughput runs one test with the configured method
+func measureThroughput(config *SpeedtestConfig) (ThroughputResult, error) {
+	duration := config.Duration.Duration()
+	if duration <= 0 {
+		duration = 10 * time.Second
+	}
+
+	result := ThroughputResult{Time: time.Now(), Method: config.Method}
+	var err error
+	switch config.Method {
+	case "", "http":
+		result.Method, result.Target = "http", config.URL
+		result.Mbps, err = httpThroughput(config.URL, duration)
+	case "iperf3":
+		result.Target = config.Server
+		result.Mbps, err = iperf3Throughput(config.Server, duration)
+	default:
+		err = fmt.Errorf("unknown speed test method %q", config.Method)
+	}
+	return result, err
+}
+
+// httpThroughput downloads url for at most duration and returns the average rate
+func httpThroughput(url string, duration time.Duration) (float64, error) {
+	client := &http.Client{Timeout: duration}
+	start := time.Now()
+	resp, err := client.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	// Hitting the client timeout ends the test, it is not an error once data has arrived
+	n, err := io.Copy(io.Discard, resp.Body)
+	elapsed := time.Since(start)
+	if n == 0 {
+		return 0, fmt.Errorf("no data received: %v", err)
+	}
+	return float64(n) * 8 / elapsed.Seconds() / 1e6, nil
+}
+
+// iperf3Throughput runs the iperf3 client in reverse mode, so the server sends and the download rate is measured
+func iperf3Throughput(server string, duration time.Duration) (float64, error) {
+	host, port := server, ""
+	if h, p, err := net.SplitHostPort(server); err == nil {
+		host, port = h, p
+	}
+	args := []string{"-c", host, "-R", "-J", "-t", strconv.Itoa(int(duration.Seconds()))}
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+
+	output, err := exec.Command("iperf3", args...).Output()
+	var report struct {
+		End struct {
+			SumReceived struct {
+				BitsPerSecond float64 `json:"bits_per_second"`
+			} `json:"sum_received"`
+		} `json:"end"`
+		Error string `json:"error"`
+	}
+	if jsonErr := json.Unmarshal(output, &report); jsonErr != nil {
+		if err != nil {
+			return 0, fmt.Errorf("could not run iperf3: %w", err)
+		}
+		return 0, fmt.Errorf("could not parse iperf3 output: %w", jsonErr)
+	}
+	if report.Error != "" {
+		return 0, fmt.Errorf("iperf3: %s", report.Error)
+	}
+	return report.End.SumReceived.BitsPerSecond / 1e6, nil
+}
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// stateStore holds the last known status of every device.
+// With a shared backend several replicas see the same state and split the devices between them.
+type stateStore interface {
+	// SwapState stores the state of a device and returns the previous one.
+	// The swap is atomic across replicas, so only one of them observes (and notifies about) a change.
+	SwapState(ip string, state DeviceState) (previous DeviceState, existed bool)
+	// Mute silences a device until the given time; a zero time unmutes it
+	Mute(ip string, until time.Time) error
+	// Mutes returns the mute deadline of every muted device
+	Mutes() (map[string]time.Time, error)
+	// Ack records who handles the outage of a device, so no replica escalates it further; an empty by clears it
+	Ack(ip, by string) error
+	// Acks returns who acknowledged each acknowledged device
+	Acks() (map[string]string, error)
+	// Heartbeat keeps this replica in the member list for memberTTL
+	Heartbeat() error
+	// Members returns the names of all live replicas, or nil when state is not shared
+	Members() []string
+	// ClaimShard records the shard this instance monitors, and ShardClaims returns the shard of every
+	// live replica that claimed one. Both do nothing when state is not shared.
+	ClaimShard(shard string) error
+	ShardClaims() (map[string]string, error)
+
+	// SaveToken, Tokens and DeleteToken manage the inbound API tokens
+	SaveToken(token APIToken) error
+	Tokens() ([]APIToken, error)
+	DeleteToken(id string) error
+
+	// AddBlackout, Blackouts and DeleteBlackout manage ad-hoc maintenance blackouts.
+	// Blackouts returns only those that have not ended yet.
+	AddBlackout(blackout Blackout) error
+	Blackouts() ([]Blackout, error)
+	DeleteBlackout(id string) error
+}
+
+// StateConfig selects where device state is kept
+type StateConfig struct {
+	Backend  string `yaml:"backend"`  // "memory" (default) or "redis"
+	Address  string `yaml:"address"`  // Redis address, e.g. "redis:6379"
+	DB       int    `yaml:"db"`       // Redis database number
+	Prefix   string `yaml:"prefix"`   // Key prefix, defaults to "pinggo"
+	Password string `yaml:"password"` // Defaults to the REDIS_PASSWORD environment variable
+	// Files API tokens and blackouts are kept in with the memory backend
+	TokenFile    string `yaml:"token_file"`    // Defaults to "tokens.json"
+	BlackoutFile string `yaml:"blackout_file"` // Defaults to "blackouts.json"
+}
+
+// newStateStore creates the configured state store; without configuration state is kept in memory
+func newStateStore(config *StateConfig, instance string) (stateStore, error) {
+	if config == nil || config.Backend == "" || config.Backend == "memory" {
+		s := &memoryState{
+			states:       make(map[string]DeviceState),
+			mutes:        make(map[string]time.Time),
+			acks:         make(map[string]string),
+			tokenFile:    "tokens.json",
+			blackoutFile: "blackouts.json",
+		}
+		if config != nil && config.TokenFile != "" {
+			s.tokenFile = config.TokenFile
+		}
+		if config != nil && config.BlackoutFile != "" {
+			s.blackoutFile = config.BlackoutFile
+		}
+		return s, nil
+	}
+	if config.Backend != "redis" {
+		return nil, fmt.Errorf("unsupported state backend %q", config.Backend)
+	}
+
+	password := config.Password
+	if password == "" {
+		password = os.Getenv("REDIS_PASSWORD")
+	}
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = "pinggo"
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: config.Address, Password: password, DB: config.DB})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("could not connect to Redis at %s: %w", config.Address, err)
+	}
+
+	return &redisState{client: client, prefix: prefix, instance: instance}, nil
+}
+
+// memoryState keeps device state in the local process. API tokens and blackouts are persisted
+// to files because they are managed by a separate CLI invocation.
+type memoryState struct {
+	mu           sync.Mutex
+	states       map[string]DeviceState
+	mutes        map[string]time.Time
+	acks         map[string]string
+	tokenFile    string
+	blackoutFile string
+}
+
+func (s *memoryState) SwapState(ip string, state DeviceState) (DeviceState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, existed := s.states[ip]
+	s.states[ip] = state
+	return previous, existed
+}
+
+func (s *memoryState) Mute(ip string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if until.IsZero() {
+		delete(s.mutes, ip)
+	} else {
+		s.mutes[ip] = until
+	}
+	return nil
+}
+
+func (s *memoryState) Mutes() (map[string]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	mutes := make(map[string]time.Time, len(s.mutes))
+	for ip, until := range s.mutes {
+		mutes[ip] = until
+	}
+	return mutes, nil
+}
+
+func (s *memoryState) Ack(ip, by string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if by == "" {
+		delete(s.acks, ip)
+	} else {
+		s.acks[ip] = by
+	}
+	return nil
+}
+
+func (s *memoryState) Acks() (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	acks := make(map[string]string, len(s.acks))
+	for ip, by := range s.acks {
+		acks[ip] = by
+	}
+	return acks, nil
+}
+
+func (s *memoryState) Heartbeat() error {
+	return nil
+}
+
+func (s *memoryState) Members() []string {
+	return nil
+}
+
+func (s *memoryState) ClaimShard(shard string) error {
+	return nil
+}
+
+func (s *memoryState) ShardClaims() (map[string]string, error) {
+	return nil, nil
+}
+
+func (s *memoryState) SaveToken(token APIToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tokens []APIToken
+	if err := readJSONFile(s.tokenFile, &tokens); err != nil {
+		return err
+	}
+	return writeJSONFile(s.tokenFile, append(tokens, token), 0o600)
+}
+
+func (s *memoryState) Tokens() ([]APIToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tokens []APIToken
+	err := readJSONFile(s.tokenFile, &tokens)
+	return tokens, err
+}
+
+func (s *memoryState) DeleteToken(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var tokens []APIToken
+	if err := readJSONFile(s.tokenFile, &tokens); err != nil {
+		return err
+	}
+	for i, token := range tokens {
+		if token.ID == id {
+			return writeJSONFile(s.tokenFile, append(tokens[:i], tokens[i+1:]...), 0o600)
+		}
+	}
+	return fmt.Errorf("token %s not found", id)
+}
+
+func (s *memoryState) AddBlackout(blackout Blackout) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blackouts, err := s.activeBlackouts()
+	if err != nil {
+		return err
+	}
+	return writeJSONFile(s.blackoutFile, append(blackouts, blackout), 0o644)
+}
+
+func (s *memoryState) Blackouts() ([]Blackout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activeBlackouts()
+}
+
+func (s *memoryState) DeleteBlackout(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blackouts, err := s.activeBlackouts()
+	if err != nil {
+		return err
+	}
+	for i, blackout := range blackouts {
+		if blackout.ID == id {
+			return writeJSONFile(s.blackoutFile, append(blackouts[:i], blackouts[i+1:]...), 0o644)
+		}
+	}
+	return fmt.Errorf("blackout %s not found", id)
+}
+
+// activeBlackouts reads the blackout file, leaving out blackouts that have ended
+func (s *memoryState) activeBlackouts() ([]Blackout, error) {
+	var blackouts []Blackout
+	if err := readJSONFile(s.blackoutFile, &blackouts); err != nil {
+		return nil, err
+	}
+	return pruneBlackouts(blackouts, time.Now()), nil
+}
+
+// readJSONFile decodes the file into v; a missing file leaves v untouched
+func readJSONFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("could not parse %s: %w", path, err)
+	}
+	return nil
+}
+
+func writeJSONFile(path string, v interface{}, perm os.FileMode) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return fmt.Errorf("could not write %s: %w", path, err)
+	}
+	return nil
+}
+
+// redisState shares device state and replica membership through Redis
+type redisState struct {
+	client   *redis.Client
+	prefix   string
+	instance string
+}
+
+// memberTTL is how long a replica stays in the member list without a heartbeat. Heartbeats are sent every
+// heartbeatInterval from their own goroutine, independent of how long a check cycle takes.
+const (
+	memberTTL         = 90 * time.Second
+	heartbeatInterval = memberTTL / 3
+)
+
+func (s *redisState) SwapState(ip string, state DeviceState) (DeviceState, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	previous, err := s.client.GetSet(ctx, s.prefix+":state:"+ip, string(state)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false
+	}
+	if err != nil {
+		// Treat the state as unchanged rather than risk a notification storm while Redis is unavailable
+		fmt.Printf("Error updating shared state of %s: %v\n", ip, err)
+		return state, true
+	}
+	return DeviceState(previous), true
+}
+
+func (s *redisState) Mute(ip string, until time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if until.IsZero() {
+		return s.client.HDel(ctx, s.prefix+":mutes", ip).Err()
+	}
+	return s.client.HSet(ctx, s.prefix+":mutes", ip, until.Unix()).Err()
+}
+
+func (s *redisState) Mutes() (map[string]time.Time, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	values, err := s.client.HGetAll(ctx, s.prefix+":mutes").Result()
+	if err != nil {
+		return nil, fmt.Errorf("could not load mutes: %w", err)
+	}
+	mutes := make(map[string]time.Time, len(values))
+	for ip, value := range values {
+		unix, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		mutes[ip] = time.Unix(unix, 0)
+	}
+	return mutes, nil
+}
+
+func (s *redisState) Ack(ip, by string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if by == "" {
+		return s.client.HDel(ctx, s.prefix+":acks", ip).Err()
+	}
+	return s.client.HSet(ctx, s.prefix+":acks", ip, by).Err()
+}
+
+func (s *redisState) Acks() (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	acks, err := s.client.HGetAll(ctx, s.prefix+":acks").Result()
+	if err != nil {
+		return nil, fmt.Errorf("could not load acks: %w", err)
+	}
+	return acks, nil
+}
+
+// Heartbeat records this replica as alive and drops the replicas not seen within memberTTL
+func (s *redisState) Heartbeat() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := s.prefix + ":members"
+	now := time.Now()
+	pipe := s.client.TxPipeline()
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Unix()), Member: s.instance})
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Add(-memberTTL).Unix(), 10))
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Members returns every replica with a heartbeat within memberTTL
+func (s *redisState) Members() []string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	min := strconv.FormatInt(time.Now().Add(-memberTTL).Unix(), 10)
+	members, err := s.client.ZRangeByScore(ctx, s.prefix+":members", &redis.ZRangeBy{Min: min, Max: "+inf"}).Result()
+	if err != nil {
+		fmt.Printf("Error reading replica membership: %v\n", err)
+		return nil
+	}
+	return members
+}
+
+func (s *redisState) ClaimShard(shard string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.client.HSet(ctx, s.prefix+":shards", s.instance, shard).Err()
+}
+
+// ShardClaims returns the claims of the live replicas and drops those of replicas that stopped
+func (s *redisState) ShardClaims() (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	key := s.prefix + ":shards"
+	claims, err := s.client.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, fmt.Errorf("could not load shard claims: %w", err)
+	}
+	live := make(map[string]bool)
+	for _, member := range s.Members() {
+		live[member] = true
+	}
+	for instance := range claims {
+		if !live[instance] {
+			s.client.HDel(ctx, key, instance)
+			delete(claims, instance)
+		}
+	}
+	return claims, nil
+}
+
+func (s *redisState) SaveToken(token APIToken) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("could not encode token: %w", err)
+	}
+	return s.client.HSet(ctx, s.prefix+":tokens", token.ID, data).Err()
+}
+
+func (s *redisState) Tokens() ([]APIToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	values, err := s.client.HVals(ctx, s.prefix+":tokens").Result()
+	if err != nil {
+		return nil, fmt.Errorf("could not load tokens: %w", err)
+	}
+	tokens := make([]APIToken, 0, len(values))
+	for _, value := range values {
+		var token APIToken
+		if err := json.Unmarshal([]byte(value), &token); err != nil {
+			return nil, fmt.Errorf("could not parse token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens, nil
+}
+
+func (s *redisState) DeleteToken(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	deleted, err := s.client.HDel(ctx, s.prefix+":tokens", id).Result()
+	if err != nil {
+		return fmt.Errorf("could not delete token: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("token %s not found", id)
+	}
+	return nil
+}
+
+func (s *redisState) AddBlackout(blackout Blackout) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	data, err := json.Marshal(blackout)
+	if err != nil {
+		return fmt.Errorf("could not encode blackout: %w", err)
+	}
+	return s.client.HSet(ctx, s.prefix+":blackouts", blackout.ID, data).Err()
+}
+
+func (s *redisState) Blackouts() ([]Blackout, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	values, err := s.client.HGetAll(ctx, s.prefix+":blackouts").Result()
+	if err != nil {
+		return nil, fmt.Errorf("could not load blackouts: %w", err)
+	}
+
+	now := time.Now()
+	var blackouts []Blackout
+	for id, value := range values {
+		var blackout Blackout
+		if err := json.Unmarshal([]byte(value), &blackout); err != nil {
+			return nil, fmt.Errorf("could not parse blackout: %w", err)
+		}
+		if !now.Before(blackout.Until) {
+			s.client.HDel(ctx, s.prefix+":blackouts", id)
+			continue
+		}
+		blackouts = append(blackouts, blackout)
+	}
+	sort.Slice(blackouts, func(i, j int) bool { return blackouts[i].From.Before(blackouts[j].From) })
+	return blackouts, nil
+}
+
+func (s *redisState) DeleteBlackout(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	deleted, err := s.client.HDel(ctx, s.prefix+":blackouts", id).Result()
+	if err != nil {
+		return fmt.Errorf("could not delete blackout: %w", err)
+	}
+	if deleted == 0 {
+		return fmt.Errorf("blackout %s not found", id)
+	}
+	return nil
+}
+
+// ownedDevices returns the devices this instance is responsible for.
+// Devices are placed on a consistent hash ring of the live members, so a replica joining or
+// leaving only moves the devices adjacent to it.
+func ownedDevices(devices []Device, members []string, instance string) []Device {
+	if len(members) < 2 {
+		return devices
+	}
+
+	const virtualNodes = 64
+	type node struct {
+		hash   uint32
+		member string
+	}
+	ring := make([]node, 0, len(members)*virtualNodes)
+	for _, member := range members {
+		for i := 0; i < virtualNodes; i++ {
+			ring = append(ring, node{hash: hashKey(member + "#" + strconv.Itoa(i)), member: member})
+		}
+	}
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	var owned []Device
+	for _, device := range devices {
+		h := hashKey(device.IP)
+		i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+		if i == len(ring) {
+			i = 0
+		}
+		if ring[i].member == instance {
+			owned = append(owned, device)
+		}
+	}
+	return owned
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
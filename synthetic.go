@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-ping/ping"
+)
+
+// syntheticPingStats answers for a synthetic device: every probe is lost while its outage window is active,
+// every probe answers otherwise. Nothing is sent on the network.
+func syntheticPingStats(device Device, count int, now time.Time) *ping.Statistics {
+	stats := &ping.Statistics{Addr: device.IP, PacketsSent: count}
+	if device.Outage.Active(now) {
+		stats.PacketLoss = 100
+		return stats
+	}
+	stats.PacketsRecv = count
+	return stats
+}
+
+// resolveSynthetic checks the outage window of a synthetic device and drops the inherited settings that only
+// make sense for real hosts, such as confirmation probes and port scans
+func resolveSynthetic(device Device) (Device, error) {
+	if device.Outage == nil {
+		return device, fmt.Errorf("synthetic device %s needs an outage window", device.Description)
+	}
+	_, err1 := time.Parse("15:04", device.Outage.From)
+	_, err2 := time.Parse("15:04", device.Outage.To)
+	if err1 != nil || err2 != nil || device.Outage.From == device.Outage.To {
+		return device, fmt.Errorf("synthetic device %s has an invalid outage window, expected from and to as HH:MM", device.Description)
+	}
+	if device.IP == "" {
+		device.IP = "synthetic:" + device.Description
+	}
+	device.Confirm = ""
+	device.Ports = nil
+	device.ExpectedPorts = nil
+	device.TLSPorts = nil
+	device.Scope = "lan" // Never counted as an internet target by the uplink classification
+	return device, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// TicketingConfig opens a Jira issue or ServiceNow incident when a critical device stays down.
+// The password or API token is read from the TICKET_TOKEN environment variable.
+type TicketingConfig struct {
+	System    string   `yaml:"system"`     // "jira" or "servicenow"
+	URL       string   `yaml:"url"`        // e.g. "https://acme.atlassian.net" or "https://acme.service-now.com"
+	User      string   `yaml:"user"`       // Jira account e-mail or ServiceNow user
+	Project   string   `yaml:"project"`    // Jira project key
+	IssueType string   `yaml:"issue_type"` // Jira issue type, defaults to "Task"
+	After     Duration `yaml:"after"`      // How long a critical device must be down before a ticket is opened (default 10m)
+}
+
+// ticketer tracks outages of critical devices and the tickets opened for them
+type ticketer struct {
+	config *TicketingConfig
+	token  string
+	client *http.Client
+
+	outages map[string]*outage // By IP
+}
+
+type outage struct {
+	since  time.Time
+	ticket string // Jira issue key or ServiceNow sys_id, empty until a ticket is opened
+}
+
+func newTicketer(config *TicketingConfig) (*ticketer, error) {
+	if config.System != "jira" && config.System != "servicenow" {
+		return nil, fmt.Errorf("unsupported ticketing system %q", config.System)
+	}
+	if config.URL == "" || config.User == "" {
+		return nil, fmt.Errorf("ticketing url and user are required")
+	}
+	if config.System == "jira" && config.Project == "" {
+		return nil, fmt.Errorf("ticketing project is required for jira")
+	}
+	token := os.Getenv("TICKET_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("TICKET_TOKEN is missing in the environment variables")
+	}
+	if config.IssueType == "" {
+		config.IssueType = "Task"
+	}
+	if config.After <= 0 {
+		config.After = Duration(10 * time.Minute)
+	}
+	return &ticketer{
+		config:  config,
+		token:   token,
+		client:  &http.Client{Timeout: 15 * time.Second},
+		outages: make(map[string]*outage),
+	}, nil
+}
+
+// Update opens tickets for critical devices down longer than the threshold and notes recoveries on open tickets.
+// Opened tickets are added to the incident timeline. It is only called from the check loop.
+func (t *ticketer) Update(devices []Device, results []DeviceResult, incidents *incidentTracker, now time.Time) {
+	for _, result := range results {
+		device, ok := findDevice(devices, result.IP)
+		if !ok || device.Severity != "critical" {
+			continue
+		}
+
+		current, tracked := t.outages[result.IP]
+		if result.State == StateDown {
+			if !tracked {
+				t.outages[result.IP] = &outage{since: now}
+				continue
+			}
+			if current.ticket == "" && now.Sub(current.since) >= t.config.After.Duration() {
+				ticket, err := t.open(device, current.since)
+				if recordDelivery("ticketing", err) != nil {
+					fmt.Printf("Error opening ticket for %s: %v\n", device.Description, err)
+					continue
+				}
+				fmt.Printf("Opened ticket %s for %s\n", ticket, device.Description)
+				incidents.Notified(device.IP, "ticket "+ticket, now)
+				current.ticket = ticket
+			}
+			continue
+		}
+
+		// Only a device that is up again ends an outage. Flapping, maintenance and mutes keep it tracked,
+		// so a device bouncing between down and flapping keeps its ticket and its start time.
+		if !tracked || !result.State.Recovered() {
+			continue
+		}
+		if current.ticket != "" {
+			note := fmt.Sprintf("%s (%s) is reachable again at %s (state %s) after %s down.",
+				device.Description, device.IP, now.Format(time.RFC3339), result.State, now.Sub(current.since).Round(time.Second))
+			if err := recordDelivery("ticketing", t.comment(current.ticket, note)); err != nil {
+				fmt.Printf("Error updating ticket %s: %v\n", current.ticket, err)
+				continue
+			}
+		}
+		delete(t.outages, result.IP)
+	}
+}
+
+// open creates a ticket and returns its key
+func (t *ticketer) open(device Device, since time.Time) (string, error) {
+	summary := fmt.Sprintf("%s (%s) is down", device.Description, device.IP)
+	description := fmt.Sprintf("%s (%s) has been unreachable since %s.", device.Description, device.IP, since.Format(time.RFC3339))
+	if device.Group != "" {
+		description += "\nGroup: " + device.Group
+	}
+
+	switch t.config.System {
+	case "jira":
+		payload := map[string]interface{}{
+			"fields": map[string]interface{}{
+				"project":     map[string]string{"key": t.config.Project},
+				"summary":     summary,
+				"description": description,
+				"issuetype":   map[string]string{"name": t.config.IssueType},
+			},
+		}
+		var response struct {
+			Key string `json:"key"`
+		}
+		if err := t.request(http.MethodPost, "/rest/api/2/issue", payload, &response); err != nil {
+			return "", err
+		}
+		return response.Key, nil
+	default:
+		payload := map[string]string{
+			"short_description": summary,
+			"description":       description,
+			"impact":            "1",
+			"urgency":           "1",
+		}
+		var response struct {
+			Result struct {
+				SysID  string `json:"sys_id"`
+				Number string `json:"number"`
+			} `json:"result"`
+		}
+		if err := t.request(http.MethodPost, "/api/now/table/incident", payload, &response); err != nil {
+			return "", err
+		}
+		return response.Result.SysID, nil
+	}
+}
+
+// comment appends a note to an open ticket
+func (t *ticketer) comment(ticket, note string) error {
+	if t.config.System == "jira" {
+		return t.request(http.MethodPost, "/rest/api/2/issue/"+ticket+"/comment", map[string]string{"body": note}, nil)
+	}
+	return t.request(http.MethodPatch, "/api/now/table/incident/"+ticket, map[string]string{"work_notes": note}, nil)
+}
+
+// request sends a JSON request with basic authentication and decodes the response into result, if not nil
+func (t *ticketer) request(method, path string, payload, result interface{}) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("could not encode request: %w", err)
+	}
+	req, err := http.NewRequest(method, strings.TrimSuffix(t.config.URL, "/")+path, bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.SetBasicAuth(t.config.User, t.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not reach %s: %w", t.config.System, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("could not decode response: %w", err)
+	}
+	return nil
+}
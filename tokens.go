@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// API token scopes; "write" includes "read"
+const (
+	scopeRead  = "read"
+	scopeWrite = "write"
+)
+
+// APIToken is an inbound API credential. Only the SHA-256 hash of the secret is stored.
+type APIToken struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	Hash      string    `json:"hash"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// HasScope reports whether the token grants scope
+func (t APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope || (s == scopeWrite && scope == scopeRead) {
+			return true
+		}
+	}
+	return false
+}
+
+// newAPIToken generates a token and returns it together with the secret value to hand out.
+// The value has the form "pgt_<id>_<secret>" so the token can be looked up without scanning all hashes.
+func newAPIToken(name string, scopes []string) (APIToken, string, error) {
+	for _, scope := range scopes {
+		if scope != scopeRead && scope != scopeWrite {
+			return APIToken{}, "", fmt.Errorf("unknown scope %q, expected %s or %s", scope, scopeRead, scopeWrite)
+		}
+	}
+
+	random := make([]byte, 36)
+	if _, err := rand.Read(random); err != nil {
+		return APIToken{}, "", fmt.Errorf("could not generate token: %w", err)
+	}
+	id := hex.EncodeToString(random[:4])
+	value := "pgt_" + id + "_" + hex.EncodeToString(random[4:])
+
+	return APIToken{
+		ID:        id,
+		Name:      name,
+		Scopes:    scopes,
+		Hash:      sha256Hex([]byte(value)),
+		CreatedAt: time.Now().UTC(),
+	}, value, nil
+}
+
+// authenticateToken returns the stored token matching value
+func authenticateToken(state stateStore, value string) (APIToken, bool) {
+	parts := strings.SplitN(value, "_", 3)
+	if len(parts) != 3 || parts[0] != "pgt" {
+		return APIToken{}, false
+	}
+	tokens, err := state.Tokens()
+	if err != nil {
+		fmt.Printf("Error loading API tokens: %v\n", err)
+		return APIToken{}, false
+	}
+	hash := sha256Hex([]byte(value))
+	for _, token := range tokens {
+		if token.ID == parts[1] && subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hash)) == 1 {
+			return token, true
+		}
+	}
+	return APIToken{}, false
+}
+
+type tokenOptions struct {
+	name, scopes string
+}
+
+// flags declares the flags of "token create"
+func (o *tokenOptions) flags(fs *flag.FlagSet) {
+	fs.StringVar(&o.name, "name", "", "what the token is used for")
+	fs.StringVar(&o.scopes, "scopes", scopeRead, "comma separated scopes: read, write")
+}
+
+// runTokenCommand implements "ping_monitor token create|list|revoke"
+func runTokenCommand(state stateStore, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: token create|list|revoke")
+	}
+
+	switch args[0] {
+	case "create":
+		var options tokenOptions
+		fs := flag.NewFlagSet("token create", flag.ExitOnError)
+		options.flags(fs)
+		fs.Parse(args[1:])
+		if options.name == "" {
+			return fmt.Errorf("--name is required")
+		}
+
+		token, value, err := newAPIToken(options.name, strings.Split(options.scopes, ","))
+		if err != nil {
+			return err
+		}
+		if err := state.SaveToken(token); err != nil {
+			return err
+		}
+		fmt.Printf("Created token %s (%s) with scopes %s\n", token.ID, token.Name, strings.Join(token.Scopes, ","))
+		fmt.Printf("Token: %s\n", value)
+		fmt.Println("Store it now, it cannot be shown again.")
+
+	case "list":
+		tokens, err := state.Tokens()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("| %-8s | %-20s | %-12s | %-20s |\n", "ID", "Name", "Scopes", "Created")
+		fmt.Println("|----------|----------------------|--------------|----------------------|")
+		for _, token := range tokens {
+			fmt.Printf("| %-8s | %-20s | %-12s | %-20s |\n", token.ID, token.Name, strings.Join(token.Scopes, ","), token.CreatedAt.Format(time.RFC3339))
+		}
+
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: token revoke <id>")
+		}
+		if err := state.DeleteToken(args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked token %s\n", args[1])
+
+	default:
+		return fmt.Errorf("unknown token command %q", args[0])
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// findDevice looks up a device by IP or (case-insensitive) description
+func findDevice(devices []Device, ref string) (Device, bool) {
+	for _, device := range devices {
+		if device.IP == ref || strings.EqualFold(device.Description, ref) {
+			return device, true
+		}
+	}
+	return Device{}, false
+}
+
+// upstreamOutage walks the depends_on chain of a device and returns the topmost upstream device
+// that is offline, i.e. the most likely reason the device cannot be reached
+func upstreamOutage(device Device, devices []Device, offline map[string]bool) (Device, bool) {
+	var root Device
+	found := false
+	visited := map[string]bool{device.IP: true}
+	for device.DependsOn != "" {
+		parent, ok := findDevice(devices, device.DependsOn)
+		if !ok || visited[parent.IP] {
+			break
+		}
+		visited[parent.IP] = true
+		if offline[parent.IP] {
+			root, found = parent, true
+		}
+		device = parent
+	}
+	return root, found
+}
+
+// formatStatusChanges renders the status changes of a cycle. Devices that went down behind a failed
+// upstream device are listed under it instead of as separate alerts, biggest outage first.
+func formatStatusChanges(changes []StatusChange, devices []Device, results []DeviceResult) string {
+	offline := make(map[string]bool)
+	for _, result := range results {
+		if !result.Reachable && result.State != StateUnknown {
+			offline[result.IP] = true
+		}
+	}
+	byIP := make(map[string]Device, len(devices))
+	for _, device := range devices {
+		byIP[device.IP] = device
+	}
+
+	var lines []string
+	var roots []string                      // IPs of devices that went down without an offline upstream
+	downstream := make(map[string][]string) // Upstream IP -> descriptions of devices unreachable behind it
+	changedDown := make(map[string]bool)
+	stable := make(map[string]string)
+	for _, change := range changes {
+		if change.State == StateFlapping {
+			lines = append(lines, fmt.Sprintf("%s   Description: %s, IP: %s is flapping, further changes are suppressed until it is stable",
+				change.State.Emoji(), change.Description, change.IP))
+			continue
+		}
+		if change.State != StateDown {
+			lines = append(lines, fmt.Sprintf("%s   Description: %s, IP: %s is %s%s", change.State.Emoji(), change.Description, change.IP, change.State, stabilized(change)))
+			continue
+		}
+		changedDown[change.IP] = true
+		stable[change.IP] = stabilized(change)
+		if upstream, ok := upstreamOutage(byIP[change.IP], devices, offline); ok {
+			downstream[upstream.IP] = append(downstream[upstream.IP], change.Description)
+		} else {
+			roots = append(roots, change.IP)
+		}
+	}
+
+	// Upstream devices that were already down still explain devices failing behind them now
+	for ip := range downstream {
+		if !changedDown[ip] {
+			roots = append(roots, ip)
+		}
+	}
+	sort.SliceStable(roots, func(i, j int) bool { return len(downstream[roots[i]]) > len(downstream[roots[j]]) })
+
+	var outages []string
+	for _, ip := range roots {
+		device := byIP[ip]
+		hosts := downstream[ip]
+		if !changedDown[ip] {
+			outages = append(outages, fmt.Sprintf("🔴   %s (%s), still down → %d more downstream hosts unreachable: %s",
+				device.Description, ip, len(hosts), strings.Join(hosts, ", ")))
+			continue
+		}
+		line := fmt.Sprintf("🔴   Description: %s, IP: %s is down%s", device.Description, ip, stable[ip])
+		if len(hosts) > 0 {
+			line += fmt.Sprintf(" → %d downstream hosts unreachable: %s", len(hosts), strings.Join(hosts, ", "))
+		}
+		outages = append(outages, line)
+	}
+
+	lines = append(outages, lines...)
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// stabilized annotates the first change after a device stopped flapping
+func stabilized(change StatusChange) string {
+	if change.PreviousState == StateFlapping {
+		return " (stable again after flapping)"
+	}
+	return ""
+}
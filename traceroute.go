@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+)
+
+// TopologyInference enables periodic traceroutes to infer depends_on relations
+type TopologyInference struct {
+	Enabled  bool     `yaml:"enabled"`
+	Interval Duration `yaml:"interval"` // Time between traceroute rounds (default 6h)
+	MaxHops  int      `yaml:"max_hops"` // Default 16
+}
+
+// dependencyInferrer traceroutes every device and uses the monitored devices found on the path as its upstream
+type dependencyInferrer struct {
+	config TopologyInference
+
+	mu       sync.Mutex
+	upstream map[string]string // Device IP -> IP of the closest monitored hop before it
+}
+
+func newDependencyInferrer(config TopologyInference) *dependencyInferrer {
+	if config.Interval <= 0 {
+		config.Interval = Duration(6 * time.Hour)
+	}
+	if config.MaxHops <= 0 {
+		config.MaxHops = 16
+	}
+	return &dependencyInferrer{config: config, upstream: make(map[string]string)}
+}
+
+// Apply fills in depends_on for devices the operator has not configured it for
+func (d *dependencyInferrer) Apply(devices []Device) []Device {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make([]Device, len(devices))
+	for i, device := range devices {
+		if device.DependsOn == "" {
+			device.DependsOn = d.upstream[device.IP]
+		}
+		result[i] = device
+	}
+	return result
+}
+
+// Run traceroutes the devices returned by list every interval
+func (d *dependencyInferrer) Run(list func() []Device) {
+	// Give the first cycle time to populate the device list
+	time.Sleep(time.Minute)
+	for {
+		devices := list()
+		monitored := make(map[string]bool, len(devices))
+		for _, device := range devices {
+			monitored[device.IP] = true
+		}
+
+		inferred := make(map[string]string)
+		for _, device := range devices {
+			hops, err := traceroute(device.IP, d.config.MaxHops)
+			if err != nil {
+				fmt.Printf("Traceroute to %s failed: %v\n", device.IP, err)
+				continue
+			}
+			// The closest monitored hop before the device is the one it most directly depends on
+			for i := len(hops) - 1; i >= 0; i-- {
+				if hops[i] != device.IP && monitored[hops[i]] {
+					inferred[device.IP] = hops[i]
+					break
+				}
+			}
+		}
+
+		d.mu.Lock()
+		d.upstream = inferred
+		d.mu.Unlock()
+		fmt.Printf("Topology inference: found upstream devices for %d of %d devices\n", len(inferred), len(devices))
+
+		time.Sleep(d.config.Interval.Duration())
+	}
+}
+
+// traceroute returns the addresses of the hops on the path to ip, ending with ip itself if it answered.
+// Hops that do not answer are returned as empty strings. Raw ICMP sockets require root/CAP_NET_RAW.
+func traceroute(ip string, maxHops int) ([]string, error) {
+	dst, err := net.ResolveIPAddr("ip4", ip)
+	if err != nil {
+		return nil, fmt.Errorf("could not resolve %s: %w", ip, err)
+	}
+
+	conn, err := icmp.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return nil, fmt.Errorf("could not open ICMP socket: %w", err)
+	}
+	defer conn.Close()
+
+	id := os.Getpid() & 0xffff
+	var hops []string
+	buf := make([]byte, 1500)
+	for ttl := 1; ttl <= maxHops; ttl++ {
+		if err := conn.IPv4PacketConn().SetTTL(ttl); err != nil {
+			return nil, fmt.Errorf("could not set TTL: %w", err)
+		}
+		msg := icmp.Message{
+			Type: ipv4.ICMPTypeEcho,
+			Body: &icmp.Echo{ID: id, Seq: ttl, Data: []byte("pinggo-traceroute")},
+		}
+		packet, err := msg.Marshal(nil)
+		if err != nil {
+			return nil, fmt.Errorf("could not build ICMP packet: %w", err)
+		}
+		if _, err := conn.WriteTo(packet, dst); err != nil {
+			return nil, fmt.Errorf("could not send ICMP packet: %w", err)
+		}
+
+		hop, reached := "", false
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		for hop == "" {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				break // Timeout, the hop does not answer
+			}
+			reply, err := icmp.ParseMessage(1, buf[:n]) // 1 = ICMP for IPv4
+			if err != nil {
+				continue
+			}
+			switch body := reply.Body.(type) {
+			case *icmp.Echo:
+				if reply.Type == ipv4.ICMPTypeEchoReply && body.ID == id && body.Seq == ttl {
+					hop, reached = from.String(), true
+				}
+			case *icmp.TimeExceeded:
+				if echoID, seq, ok := quotedEcho(body.Data); ok && echoID == id && seq == ttl {
+					hop = from.String()
+				}
+			}
+		}
+
+		hops = append(hops, hop)
+		if reached {
+			break
+		}
+	}
+	return hops, nil
+}
+
+// quotedEcho extracts the ID and sequence of our echo request quoted in an ICMP error message
+func quotedEcho(data []byte) (id, seq int, ok bool) {
+	if len(data) < 20 {
+		return 0, 0, false
+	}
+	headerLen := int(data[0]&0x0f) * 4
+	if len(data) < headerLen+8 {
+		return 0, 0, false
+	}
+	echo := data[headerLen:]
+	return int(binary.BigEndian.Uint16(echo[4:6])), int(binary.BigEndian.Uint16(echo[6:8])), true
+}
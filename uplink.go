@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// UplinkConfig detects ISP/uplink outages: most internet targets failing while the LAN is fine
+type UplinkConfig struct {
+	Enabled       bool    `yaml:"enabled"`
+	FailedPercent float64 `yaml:"failed_percent"` // Share of WAN targets that must be unreachable, default 80
+	MinTargets    int     `yaml:"min_targets"`    // WAN targets needed to tell an uplink outage apart from a single host, default 2
+	IPService     string  `yaml:"ip_service"`     // HTTP(S) URL returning the external IP as plain text or "stun:<host>:<port>", default "https://api.ipify.org"
+}
+
+// uplinkClassifier tracks whether the uplink is down and the last external IP seen while it was up
+type uplinkClassifier struct {
+	config *UplinkConfig
+
+	down        bool
+	since       time.Time
+	externalIP  string
+	ipCheckedAt time.Time
+}
+
+func newUplinkClassifier(config *UplinkConfig) *uplinkClassifier {
+	if config.FailedPercent <= 0 {
+		config.FailedPercent = 80
+	}
+	if config.MinTargets <= 0 {
+		config.MinTargets = 2
+	}
+	if config.IPService == "" {
+		config.IPService = "https://api.ipify.org"
+	}
+	return &uplinkClassifier{config: config}
+}
+
+// isWAN reports whether a device is an internet target: scope "wan", or a public address without a scope
+func isWAN(device Device) bool {
+	if device.Scope != "" {
+		return device.Scope == "wan"
+	}
+	ip := net.ParseIP(device.IP)
+	return ip != nil && !ip.IsPrivate() && !ip.IsLoopback() && !ip.IsLinkLocalUnicast()
+}
+
+// Classify updates the uplink state from the results of a cycle. It returns a message when an outage starts or ends,
+// the WAN targets whose individual alerts are replaced by it, and, once the uplink is restored, alerts for the
+// targets that are still down: their own change to down was consumed during the outage.
+func (u *uplinkClassifier) Classify(devices []Device, results []DeviceResult, now time.Time) (string, map[string]bool, []StatusChange) {
+	byIP := make(map[string]Device, len(devices))
+	for _, device := range devices {
+		byIP[device.IP] = device
+	}
+
+	wan := make(map[string]bool)
+	wanFailed, lanUp := 0, false
+	for _, result := range results {
+		if result.State == StateUnknown {
+			continue // Not checked yet, neither failed nor up
+		}
+		if isWAN(byIP[result.IP]) {
+			wan[result.IP] = true
+			if !result.Reachable {
+				wanFailed++
+			}
+		} else if result.Reachable {
+			lanUp = true
+		}
+	}
+
+	outage := lanUp && len(wan) >= u.config.MinTargets &&
+		100*float64(wanFailed)/float64(len(wan)) >= u.config.FailedPercent
+
+	if !outage && !u.down {
+		u.refreshExternalIP(now)
+		return "", nil, nil
+	}
+	if outage && u.down {
+		return "", wan, nil
+	}
+
+	u.down = outage
+	if outage {
+		u.since = now
+		message := fmt.Sprintf("🌐 ISP/uplink outage: %d of %d internet targets unreachable, local network is up", wanFailed, len(wan))
+		if u.externalIP != "" {
+			message += fmt.Sprintf("\nLast known external IP: %s", u.externalIP)
+		}
+		return message, wan, nil
+	}
+
+	var stillDown []StatusChange
+	for _, result := range results {
+		if wan[result.IP] && result.State == StateDown {
+			stillDown = append(stillDown, StatusChange{
+				Description:   result.Description,
+				IP:            result.IP,
+				State:         StateDown,
+				PreviousState: StateDown,
+				Time:          now,
+			})
+		}
+	}
+	return fmt.Sprintf("🌐 Uplink restored after %s", now.Sub(u.since).Round(time.Second)), wan, stillDown
+}
+
+// refreshExternalIP looks up the external IP every 10 minutes while the uplink works
+func (u *uplinkClassifier) refreshExternalIP(now time.Time) {
+	if now.Sub(u.ipCheckedAt) < 10*time.Minute {
+		return
+	}
+	u.ipCheckedAt = now
+
+	ip, err := lookupPublicIP([]string{u.config.IPService})
+	if err != nil {
+		fmt.Printf("Error looking up external IP: %v\n", err)
+		return
+	}
+	u.externalIP = ip
+}
+
+// fetchExternalIP asks an HTTP service that answers with the caller's address as plain text
+func fetchExternalIP(service string) (string, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(service)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		return "", err
+	}
+	ip := strings.TrimSpace(string(body))
+	if net.ParseIP(ip) == nil {
+		return "", fmt.Errorf("%s did not return an IP address", service)
+	}
+	return ip, nil
+}
+
+// withoutDevices drops the changes of the given IPs
+func withoutDevices(changes []StatusChange, ips map[string]bool) []StatusChange {
+	if len(ips) == 0 {
+		return changes
+	}
+	var kept []StatusChange
+	for _, change := range changes {
+		if !ips[change.IP] {
+			kept = append(kept, change)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Set at build time, e.g. go build -ldflags "-X main.version=v1.4.0 -X main.commit=$(git rev-parse --short HEAD)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+// buildInfo returns the version set at build time. Without ldflags the commit and date come from the
+// VCS information Go embeds when building from a git checkout.
+func buildInfo() BuildInfo {
+	info := BuildInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+	if embedded, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range embedded.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+				if len(info.Commit) > 12 {
+					info.Commit = info.Commit[:12]
+				}
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	return info
+}
+
+func (b BuildInfo) String() string {
+	s := b.Version
+	if b.Commit != "" {
+		s += " (" + b.Commit
+		if b.BuildDate != "" {
+			s += ", " + b.BuildDate
+		}
+		s += ")"
+	}
+	return s + " " + b.GoVersion
+}
+
+// handleVersion returns the build info of the monitor
+func (m *monitor) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, buildInfo())
+}
+
+// UpdateCheckConfig looks for newer releases on GitHub and announces them
+type UpdateCheckConfig struct {
+	Repository string   `yaml:"repository"` // Default rozicdejan/pingGoModule
+	Interval   Duration `yaml:"interval"`   // Default 24h
+	Channel    string   `yaml:"channel"`    // "telegram" or the name of a webhook or chat, default telegram
+}
+
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+}
+
+// checkUpdates asks GitHub for the latest release every interval and notifies once per newer release
+func (m *monitor) checkUpdates() {
+	config := m.config.UpdateCheck
+	if _, ok := parseVersion(version); !ok {
+		fmt.Printf("Update check skipped, %q is not a release build\n", version)
+		return
+	}
+	repository := config.Repository
+	if repository == "" {
+		repository = "rozicdejan/pingGoModule"
+	}
+	interval := config.Interval.Duration()
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	channel := config.Channel
+	if channel == "" {
+		channel = "telegram"
+	}
+
+	announced := ""
+	for {
+		release, err := latestRelease(repository)
+		if err != nil {
+			fmt.Printf("Error checking for updates: %v\n", err)
+		} else if release.TagName != announced && newerVersion(release.TagName, version) {
+			message := fmt.Sprintf("⬆️ ping_monitor %s is available, this monitor runs %s\n%s", release.TagName, version, release.HTMLURL)
+			fmt.Println(message)
+			payload := map[string]interface{}{"instance": m.config.Instance, "version": version, "latest": release.TagName, "url": release.HTMLURL}
+			if err := m.notifyChannel(channel, message, payload); err != nil {
+				fmt.Printf("Error sending update notification: %v\n", err)
+			} else {
+				announced = release.TagName
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+// latestRelease returns the latest published release of a GitHub repository; drafts and pre-releases are not listed
+func latestRelease(repository string) (githubRelease, error) {
+	var release githubRelease
+	req, err := http.NewRequest(http.MethodGet, "https://api.github.com/repos/"+repository+"/releases/latest", nil)
+	if err != nil {
+		return release, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "ping_monitor/"+version)
+	client := &http.Client{Timeout: 15 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return release, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return release, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return release, fmt.Errorf("could not decode release: %w", err)
+	}
+	return release, nil
+}
+
+// parseVersion parses "v1.2.3" or "1.2"; a pre-release or build suffix such as "-rc1" is ignored
+func parseVersion(s string) ([3]int, bool) {
+	var parts [3]int
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	fields := strings.Split(s, ".")
+	if len(fields) > 3 {
+		return parts, false
+	}
+	for i, field := range fields {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+// newerVersion reports whether latest is a higher release than current
+func newerVersion(latest, current string) bool {
+	a, ok := parseVersion(latest)
+	b, ok2 := parseVersion(current)
+	if !ok || !ok2 {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] > b[i]
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		in   string
+		want [3]int
+		ok   bool
+	}{
+		{"v1.2.3", [3]int{1, 2, 3}, true},
+		{"1.2.3", [3]int{1, 2, 3}, true},
+		{"v1.2", [3]int{1, 2, 0}, true},
+		{"2", [3]int{2, 0, 0}, true},
+		{"v1.4.0-rc1", [3]int{1, 4, 0}, true},
+		{"v1.4.0+build.7", [3]int{1, 4, 0}, true},
+		{"v1.2.3.4", [3]int{}, false},
+		{"dev", [3]int{}, false},
+		{"", [3]int{}, false},
+		{"v1.x", [3]int{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseVersion(tt.in)
+		if ok != tt.ok || (ok && got != tt.want) {
+			t.Errorf("parseVersion(%q) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestNewerVersion(t *testing.T) {
+	tests := []struct {
+		latest, current string
+		want            bool
+	}{
+		{"v1.2.4", "v1.2.3", true},
+		{"v1.3.0", "v1.2.9", true},
+		{"v2.0.0", "v1.10.0", true},
+		{"v1.10.0", "v1.9.0", true}, // Numeric, not lexical
+		{"v1.2.3", "v1.2.3", false},
+		{"v1.2.3", "v1.2.4", false},
+		{"v1.2", "v1.2.0", false},
+		{"v1.3.0-rc1", "v1.2.0", true},
+		{"v1.3.0", "dev", false}, // Development builds are never told to update
+		{"garbage", "v1.0.0", false},
+	}
+	for _, tt := range tests {
+		if got := newerVersion(tt.latest, tt.current); got != tt.want {
+			t.Errorf("newerVersion(%q, %q) = %v, want %v", tt.latest, tt.current, got, tt.want)
+		}
+	}
+}
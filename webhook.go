@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Webhook is an HTTP endpoint that receives check results as JSON
+type Webhook struct {
+	Name string `yaml:"name"` // Lets escalation policies refer to the webhook
+	URL  string `yaml:"url"`
+	Mode string `yaml:"mode"` // "event" (default) posts every status change, "cycle" posts one snapshot per cycle
+
+	MinSeverity string `yaml:"min_severity"` // Event webhooks only receive changes of devices at least this severe
+
+	// Payloads are signed with HMAC-SHA256 when a secret is set
+	Secret          string `yaml:"secret"`
+	SecretEnv       string `yaml:"secret_env"`       // Environment variable holding the secret, instead of Secret
+	SignatureHeader string `yaml:"signature_header"` // Defaults to X-Signature-256
+}
+
+// DeviceResult is the outcome of checking one device in a cycle
+type DeviceResult struct {
+	Description string      `json:"description"`
+	IP          string      `json:"ip"`
+	State       DeviceState `json:"state"`
+	Reachable   bool        `json:"reachable"`        // Whether the probe got an answer, regardless of the state
+	RTTMillis   float64     `json:"rtt_ms,omitempty"` // Average round trip time
+}
+
+// StatusChange is sent to event webhooks when a device changes state
+type StatusChange struct {
+	Description   string      `json:"description"`
+	IP            string      `json:"ip"`
+	State         DeviceState `json:"state"`
+	PreviousState DeviceState `json:"previous_state,omitempty"`
+	Time          time.Time   `json:"time"`
+}
+
+// CycleSnapshot is sent to cycle webhooks once all devices have been checked
+type CycleSnapshot struct {
+	Time    time.Time      `json:"time"`
+	Results []DeviceResult `json:"results"`
+}
+
+// sendWebhooks delivers the results of a completed cycle to every configured webhook
+func sendWebhooks(webhooks []Webhook, changes []StatusChange, devices []Device, snapshot CycleSnapshot) {
+	for _, webhook := range webhooks {
+		switch webhook.Mode {
+		case "cycle":
+			if err := recordDelivery(webhook.Label(), webhook.post(snapshot)); err != nil {
+				fmt.Printf("Error sending cycle webhook to %s: %v\n", webhook.URL, err)
+			}
+		case "", "event":
+			for _, change := range filterSeverity(changes, devices, webhook.MinSeverity) {
+				if err := recordDelivery(webhook.Label(), webhook.post(change)); err != nil {
+					fmt.Printf("Error sending event webhook to %s: %v\n", webhook.URL, err)
+				}
+			}
+		default:
+			fmt.Printf("Unknown webhook mode %q for %s\n", webhook.Mode, webhook.URL)
+		}
+	}
+}
+
+// Label names the webhook in logs and metrics
+func (w Webhook) Label() string {
+	if w.Name != "" {
+		return w.Name
+	}
+	return w.URL
+}
+
+// secret returns the signing secret, empty if the webhook is unsigned. A secret_env that resolves to
+// nothing is an error, so a missing variable never turns signed deliveries into unsigned ones.
+func (w Webhook) secret() (string, error) {
+	if w.SecretEnv == "" {
+		return w.Secret, nil
+	}
+	secret := os.Getenv(w.SecretEnv)
+	if secret == "" {
+		return "", fmt.Errorf("webhook %s: secret_env %s is not set", w.Label(), w.SecretEnv)
+	}
+	return secret, nil
+}
+
+// validateWebhooks checks at startup that the secret of every signed webhook is available
+func validateWebhooks(webhooks []Webhook) error {
+	for _, webhook := range webhooks {
+		if _, err := webhook.secret(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// post encodes payload as JSON and POSTs it to the webhook, signed if a secret is configured
+func (w Webhook) post(payload interface{}) error {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("could not encode payload to JSON: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := w.sign(req, jsonData); err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sign adds timestamp, nonce and signature headers. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<nonce>.<body>", so receivers can reject both forged and replayed payloads.
+func (w Webhook) sign(req *http.Request, body []byte) error {
+	secret, err := w.secret()
+	if err != nil {
+		return err
+	}
+	if secret == "" {
+		return nil
+	}
+
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return fmt.Errorf("could not generate nonce: %w", err)
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + nonce + "."))
+	mac.Write(body)
+
+	header := w.SignatureHeader
+	if header == "" {
+		header = "X-Signature-256"
+	}
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Nonce", nonce)
+	req.Header.Set(header, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	return nil
+}